@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount 定点金额，以分为单位，避免浮点运算带来的精度问题
+type Amount int64
+
+// maxAmountDigits 金额整数部分的最大位数，保证以分为单位时不会溢出int64
+const maxAmountDigits = 16
+
+// ParseAmount 解析金额字符串，最多两位小数，不合法时返回错误
+func ParseAmount(s string) (Amount, error) {
+	text := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		negative = text[0] == '-'
+		text = text[1:]
+	}
+
+	intPart, fracPart, hasPoint := strings.Cut(text, ".")
+	if intPart == "" || (hasPoint && fracPart == "") || len(fracPart) > 2 || len(intPart) > maxAmountDigits {
+		return 0, fmt.Errorf("金额格式不正确: [%s]", s)
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("金额格式不正确: [%s]", s)
+	}
+
+	fracPart += strings.Repeat("0", 2-len(fracPart))
+	cents, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("金额格式不正确: [%s]", s)
+	}
+	if negative {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+// String 格式化为两位小数的金额字符串
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Scale 金额乘以num/den，四舍五入到分（远离零），结果超出范围或den为0时返回错误
+func (a Amount) Scale(num, den int64) (Amount, error) {
+	if den == 0 {
+		return 0, fmt.Errorf("金额%s按比例计算时分母为0", a)
+	}
+	product := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(num))
+	divisor := big.NewInt(den)
+	if divisor.Sign() < 0 {
+		product.Neg(product)
+		divisor.Neg(divisor)
+	}
+	// 绝对值加上半个分母后截断，实现远离零的四舍五入
+	negative := product.Sign() < 0
+	product.Abs(product)
+	product.Add(product, new(big.Int).Quo(divisor, big.NewInt(2)))
+	product.Quo(product, divisor)
+	if negative {
+		product.Neg(product)
+	}
+	if !product.IsInt64() {
+		return 0, fmt.Errorf("金额%s按比例%d/%d计算后超出范围", a, num, den)
+	}
+	return Amount(product.Int64()), nil
+}
+
+// isDigits 判断字符串是否全部为数字，空串返回true
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SumAmounts 累加金额，任意一个金额不合法时返回错误
+func SumAmounts(amounts []string) (Amount, error) {
+	var total Amount
+	for _, s := range amounts {
+		amt, err := ParseAmount(s)
+		if err != nil {
+			return 0, err
+		}
+		total += amt
+	}
+	return total, nil
+}
+
+// checkBatchTotals 校验批量报文的AllNum/AllAmt与明细合计是否一致
+// recompute为true时用明细合计覆盖AllNum/AllAmt，否则不一致时返回错误
+func checkBatchTotals(cfx *CFX, recompute bool) error {
+	switch {
+	case cfx.MSG.BatchHead7221 != nil:
+		head := cfx.MSG.BatchHead7221
+		var amounts []string
+		if cfx.MSG.DrawbackBody7221 != nil {
+			for _, info := range cfx.MSG.DrawbackBody7221.DrawbackInfo7221 {
+				amounts = append(amounts, info.Amt)
+			}
+		}
+		total, err := SumAmounts(amounts)
+		if err != nil {
+			return fmt.Errorf("7221明细金额错误: %v", err)
+		}
+		if recompute {
+			head.AllNum = strconv.Itoa(len(amounts))
+			head.AllAmt = total.String()
+			return nil
+		}
+		allNum, err := strconv.Atoi(strings.TrimSpace(head.AllNum))
+		if err != nil || allNum != len(amounts) {
+			return fmt.Errorf("7221 PackNo[%s]总笔数AllNum[%s]与明细笔数[%d]不一致", head.PackNo, head.AllNum, len(amounts))
+		}
+		allAmt, err := ParseAmount(head.AllAmt)
+		if err != nil || allAmt != total {
+			return fmt.Errorf("7221 PackNo[%s]总金额AllAmt[%s]与明细合计[%s]不一致", head.PackNo, head.AllAmt, total)
+		}
+	case cfx.MSG.BatchHead7211 != nil:
+		head := cfx.MSG.BatchHead7211
+		var amounts []string
+		if cfx.MSG.TaxBody7211 != nil {
+			for _, info := range cfx.MSG.TaxBody7211.TaxInfo7211 {
+				amounts = append(amounts, info.Payment7211.TraAmt)
+			}
+		}
+		total, err := SumAmounts(amounts)
+		if err != nil {
+			return fmt.Errorf("7211明细金额错误: %v", err)
+		}
+		if recompute {
+			head.AllNum = len(amounts)
+			head.AllAmt = total.String()
+			return nil
+		}
+		if head.AllNum != len(amounts) {
+			return fmt.Errorf("7211 PackNo[%s]总笔数AllNum[%d]与明细笔数[%d]不一致", head.PackNo, head.AllNum, len(amounts))
+		}
+		allAmt, err := ParseAmount(head.AllAmt)
+		if err != nil || allAmt != total {
+			return fmt.Errorf("7211 PackNo[%s]总金额AllAmt[%s]与明细合计[%s]不一致", head.PackNo, head.AllAmt, total)
+		}
+	}
+	return nil
+}
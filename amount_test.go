@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Amount
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"12", 1200, false},
+		{"12.3", 1230, false},
+		{"12.34", 1234, false},
+		{" 12.34 ", 1234, false},
+		{"+1.00", 100, false},
+		{"-1.05", -105, false},
+		{"-0.01", -1, false},
+		{"0.5", 50, false},
+		{"9999999999999999.99", 999999999999999999, false},
+		{".5", 0, true},
+		{"5.", 0, true},
+		{"1.234", 0, true},
+		{"1.2.3", 0, true},
+		{"12345678901234567.00", 0, true},
+		{"", 0, true},
+		{"-", 0, true},
+		{"1,000.00", 0, true},
+		{"1e3", 0, true},
+		{"--1", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAmount(%q) err = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{50, "0.50"},
+		{1234, "12.34"},
+		{-1, "-0.01"},
+		{-105, "-1.05"},
+		{999999999999999999, "9999999999999999.99"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %s, want %s", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestSumAmounts(t *testing.T) {
+	tests := []struct {
+		amounts []string
+		want    Amount
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{[]string{"0.10", "0.20"}, 30, false},
+		{[]string{"1.00", "-0.99"}, 1, false},
+		{[]string{"1.00", "abc"}, 0, true},
+		{[]string{"1.001"}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := SumAmounts(tt.amounts)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("SumAmounts(%q) = %d, %v, want %d, wantErr %v", tt.amounts, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAmountScale(t *testing.T) {
+	tests := []struct {
+		amount   Amount
+		num, den int64
+		want     Amount
+		wantErr  bool
+	}{
+		{100, 1, 3, 33, false},
+		{200, 1, 3, 67, false},
+		{5, 1, 2, 3, false},
+		{-5, 1, 2, -3, false},
+		{5, -1, 2, -3, false},
+		{5, 1, -2, -3, false},
+		{1234, 0, 7, 0, false},
+		{999999999999999999, 1000000, 1000000, 999999999999999999, false},
+		{math.MaxInt64, 2, 1, 0, true},
+		{100, 1, 0, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.amount.Scale(tt.num, tt.den)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Amount(%d).Scale(%d, %d) = %d, %v, want %d, wantErr %v", tt.amount, tt.num, tt.den, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckBatchTotals(t *testing.T) {
+	newCfx := func(allNum, allAmt string, amounts ...string) *CFX {
+		body := &DrawbackBody7221{}
+		for _, amt := range amounts {
+			body.DrawbackInfo7221 = append(body.DrawbackInfo7221, DrawbackInfo7221{Amt: amt})
+		}
+		return &CFX{MSG: MSG{BatchHead7221: &BatchHead7221{AllNum: allNum, AllAmt: allAmt}, DrawbackBody7221: body}}
+	}
+	tests := []struct {
+		name      string
+		cfx       *CFX
+		recompute bool
+		wantErr   bool
+		wantNum   string
+		wantAmt   string
+	}{
+		{"一致", newCfx("2", "3.30", "1.10", "2.20"), false, false, "2", "3.30"},
+		{"笔数不一致", newCfx("3", "3.30", "1.10", "2.20"), false, true, "3", "3.30"},
+		{"金额不一致", newCfx("2", "3.31", "1.10", "2.20"), false, true, "2", "3.31"},
+		{"负数金额", newCfx("2", "-0.50", "1.00", "-1.50"), false, false, "2", "-0.50"},
+		{"重新计算", newCfx("9", "9.99", "1.10", "2.20"), true, false, "2", "3.30"},
+		{"明细金额不合法", newCfx("1", "1.00", "1.001"), true, true, "1", "1.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBatchTotals(tt.cfx, tt.recompute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkBatchTotals err = %v, wantErr %v", err, tt.wantErr)
+			}
+			head := tt.cfx.MSG.BatchHead7221
+			if head.AllNum != tt.wantNum || head.AllAmt != tt.wantAmt {
+				t.Errorf("AllNum/AllAmt = %s/%s, want %s/%s", head.AllNum, head.AllAmt, tt.wantNum, tt.wantAmt)
+			}
+		})
+	}
+}
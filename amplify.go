@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// AmplifyOptions 压测放大参数
+type AmplifyOptions struct {
+	Factor        int     // 每个报文输出的份数（含原报文），小于等于1时不放大
+	AmountPercent float64 // 明细金额随机浮动的比例，如0.1表示±10%，为0时金额不变
+	PerturbPayee  bool    // 是否随机替换收款人/缴款人信息（按脱敏的默认字段）
+}
+
+// NewAmplifyOptions 根据配置生成放大参数
+func NewAmplifyOptions(setting *Setting) AmplifyOptions {
+	return AmplifyOptions{
+		Factor:        setting.AmplifyFactor,
+		AmountPercent: setting.AmplifyAmountPercent,
+		PerturbPayee:  setting.AmplifyPerturbPayee,
+	}
+}
+
+// Amplify 将每个7211/7221报文放大为Factor份
+// 副本重新生成MsgID/PackNo/TraNo/TaxVouNo/FundSrlNo，可选浮动金额和替换收付款人信息，并按明细重新计算AllNum/AllAmt
+func Amplify(outputs []*OutputData, opts AmplifyOptions) ([]*OutputData, error) {
+	if opts.Factor <= 1 {
+		return outputs, nil
+	}
+
+	result := make([]*OutputData, 0, len(outputs)*opts.Factor)
+	for _, output := range outputs {
+		result = append(result, output)
+		if output.Cfx == nil {
+			continue
+		}
+		for variant := 1; variant < opts.Factor; variant++ {
+			data, err := amplifyVariant(output, variant, opts)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, data)
+		}
+	}
+	AppLogger.Printf("压测放大: %d个报文放大为%d个", len(outputs), len(result))
+	return result, nil
+}
+
+// amplifyVariant 生成一个报文副本
+func amplifyVariant(output *OutputData, variant int, opts AmplifyOptions) (*OutputData, error) {
+	cfx, err := cloneCFX(output.Cfx)
+	if err != nil {
+		return nil, err
+	}
+
+	msgId := GenerateUniqueTipsId()
+	cfx.HEAD.MsgID = msgId
+	cfx.HEAD.MsgRef = msgId
+
+	msg := cfx.MSG
+	switch {
+	case msg.BatchHead7221 != nil:
+		msg.BatchHead7221.PackNo = GeneratePackNo()
+		if msg.DrawbackBody7221 != nil {
+			infos := msg.DrawbackBody7221.DrawbackInfo7221
+			for i := range infos {
+				infos[i].TraNo = GenerateTraNo()
+				infos[i].Amt, err = perturbAmount(infos[i].Amt, opts.AmountPercent)
+				if err != nil {
+					return nil, fmt.Errorf("7221明细TraNo[%s]金额错误: %v", infos[i].TraNo, err)
+				}
+			}
+		}
+	case msg.BatchHead7211 != nil:
+		msg.BatchHead7211.PackNo = GeneratePackNo()
+		if msg.TurnAccount7211 != nil {
+			msg.TurnAccount7211.FundSrlNo = GenerateUniqueId()
+		}
+		if msg.TaxBody7211 != nil {
+			infos := msg.TaxBody7211.TaxInfo7211
+			for i := range infos {
+				infos[i].Payment7211.TraNo = GenerateTraNo()
+				infos[i].TaxVou7211.TaxVouNo = GenerateTaxVouNo()
+				oldAmt := infos[i].Payment7211.TraAmt
+				newAmt, err := perturbAmount(oldAmt, opts.AmountPercent)
+				if err != nil {
+					return nil, fmt.Errorf("7211明细TraNo[%s]金额错误: %v", infos[i].Payment7211.TraNo, err)
+				}
+				infos[i].Payment7211.TraAmt = newAmt
+				// 税目金额按交易金额同比例调整，保持明细内金额一致
+				if err := rescaleSubjects(infos[i].TaxType7211.SubjectList7211, oldAmt, newAmt); err != nil {
+					return nil, fmt.Errorf("7211明细TraNo[%s]税目金额错误: %v", infos[i].Payment7211.TraNo, err)
+				}
+			}
+		}
+	}
+
+	maskers := []*Masker{dataMasker}
+	if opts.PerturbPayee {
+		masker, err := NewMasker([]byte(fmt.Sprintf("amplify-%s", GenerateUniqueId())), "", "")
+		if err != nil {
+			return nil, err
+		}
+		masker.MaskCFX(cfx)
+		maskers = append(maskers, masker)
+	}
+
+	// 金额浮动后按明细重新计算总笔数、总金额
+	if err := checkBatchTotals(cfx, true); err != nil {
+		return nil, err
+	}
+
+	data := &OutputData{
+		Detail7211Count: output.Detail7211Count,
+		Detail7221Count: output.Detail7221Count,
+		Cfx:             cfx,
+		SourceRefs:      output.SourceRefs,
+		Variant:         variant,
+		passThrough:     output.passThrough,
+	}
+	// 透传模式的副本同样在源报文原文上生成，源报文未脱敏，需要依次执行本次运行和副本的脱敏
+	if data.passThrough != nil {
+		if err := renderPassThrough(data, maskers...); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	data.Body, err = generateXMLString(*cfx)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// perturbPrecision 浮动比例的计算精度（百万分之一）
+const perturbPrecision = 1000000
+
+// perturbAmount 金额按比例随机浮动，按分计算，正负号保持不变且绝对值至少为0.01；percent为0或金额为0时原样返回
+func perturbAmount(value string, percent float64) (string, error) {
+	if percent <= 0 {
+		return value, nil
+	}
+	amt, err := ParseAmount(value)
+	if err != nil {
+		return "", err
+	}
+	if amt == 0 {
+		return value, nil
+	}
+	// 浮动比例在[-percent, percent]之间，随机数精确到千分之一
+	step := int64(math.Round(percent * perturbPrecision / 1000))
+	factor := int64(perturbPrecision) + int64(defaultGenerator.Intn(2001)-1000)*step
+	perturbed, err := amt.Scale(factor, perturbPrecision)
+	if err != nil {
+		return "", err
+	}
+	if amt > 0 && perturbed < 1 {
+		perturbed = 1
+	}
+	if amt < 0 && perturbed > -1 {
+		perturbed = -1
+	}
+	return perturbed.String(), nil
+}
+
+// rescaleSubjects 税目的各项金额按newAmt/oldAmt同比例调整
+// 每项金额的合计按比例计算后，舍入误差计入最后一个有该项金额的税目，保证合计与按比例调整后的一致
+func rescaleSubjects(subjects []SubjectList7211, oldAmt, newAmt string) error {
+	oldTotal, err := ParseAmount(oldAmt)
+	if err != nil {
+		return err
+	}
+	newTotal, err := ParseAmount(newAmt)
+	if err != nil {
+		return err
+	}
+	if oldTotal == 0 || oldTotal == newTotal {
+		return nil
+	}
+
+	fields := []func(*SubjectList7211) *string{
+		func(s *SubjectList7211) *string { return &s.TaxAmt },
+		func(s *SubjectList7211) *string { return &s.ExpTaxAmt },
+		func(s *SubjectList7211) *string { return &s.DiscountTaxAmt },
+		func(s *SubjectList7211) *string { return &s.FactTaxAmt },
+	}
+	for _, field := range fields {
+		var sum, scaledSum Amount
+		last := -1
+		for i := range subjects {
+			value := field(&subjects[i])
+			if *value == "" {
+				continue
+			}
+			amt, err := ParseAmount(*value)
+			if err != nil {
+				return err
+			}
+			scaled, err := amt.Scale(int64(newTotal), int64(oldTotal))
+			if err != nil {
+				return err
+			}
+			sum += amt
+			scaledSum += scaled
+			*value = scaled.String()
+			last = i
+		}
+		if last < 0 {
+			continue
+		}
+		target, err := sum.Scale(int64(newTotal), int64(oldTotal))
+		if err != nil {
+			return err
+		}
+		value := field(&subjects[last])
+		lastAmt, _ := ParseAmount(*value)
+		*value = (lastAmt + target - scaledSum).String()
+	}
+	return nil
+}
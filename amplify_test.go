@@ -0,0 +1,94 @@
+package main
+
+import "testing"
+
+func TestPerturbAmountKeepsSign(t *testing.T) {
+	tests := []struct {
+		value   string
+		percent float64
+	}{
+		{"100.00", 0.1},
+		{"0.01", 0.5},
+		{"-0.01", 0.5},
+		{"-250.37", 0.1},
+		{"0.02", 1},
+		{"-0.02", 1},
+	}
+	for _, tt := range tests {
+		amt, _ := ParseAmount(tt.value)
+		for i := 0; i < 200; i++ {
+			got, err := perturbAmount(tt.value, tt.percent)
+			if err != nil {
+				t.Fatalf("perturbAmount(%s): %v", tt.value, err)
+			}
+			perturbed, err := ParseAmount(got)
+			if err != nil {
+				t.Fatalf("perturbAmount(%s) = %s 不是合法金额", tt.value, got)
+			}
+			if (amt > 0 && perturbed < 1) || (amt < 0 && perturbed > -1) {
+				t.Fatalf("perturbAmount(%s) = %s 改变了正负号", tt.value, got)
+			}
+			limit, _ := amt.Scale(int64(tt.percent*1000)+1000, 1000)
+			if abs(perturbed) > abs(limit)+1 {
+				t.Fatalf("perturbAmount(%s, %v) = %s 超出浮动范围", tt.value, tt.percent, got)
+			}
+		}
+	}
+
+	for _, value := range []string{"0.00", "12.30"} {
+		if got, _ := perturbAmount(value, 0); got != value {
+			t.Errorf("percent为0时应原样返回: %s -> %s", value, got)
+		}
+	}
+	if got, _ := perturbAmount("0.00", 0.5); got != "0.00" {
+		t.Errorf("金额为0时应原样返回: got %s", got)
+	}
+}
+
+func abs(a Amount) Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func TestRescaleSubjects(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldAmt   string
+		newAmt   string
+		subjects []string
+		want     []string
+	}{
+		{"单个税目", "100.00", "110.00", []string{"100.00"}, []string{"110.00"}},
+		{"等分", "100.00", "50.00", []string{"60.00", "40.00"}, []string{"30.00", "20.00"}},
+		{"余数计入最后一个", "0.03", "0.04", []string{"0.01", "0.01", "0.01"}, []string{"0.01", "0.01", "0.02"}},
+		{"负数金额", "-10.00", "-12.00", []string{"-6.00", "-4.00"}, []string{"-7.20", "-4.80"}},
+		{"合计不等于交易金额", "100.00", "200.00", []string{"30.00", "20.00"}, []string{"60.00", "40.00"}},
+		{"金额不变", "100.00", "100.00", []string{"60.00", "40.00"}, []string{"60.00", "40.00"}},
+		{"原金额为0", "0.00", "1.00", []string{"0.00"}, []string{"0.00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subjects := make([]SubjectList7211, len(tt.subjects))
+			for i, amt := range tt.subjects {
+				subjects[i] = SubjectList7211{TaxAmt: amt, FactTaxAmt: amt}
+			}
+			if err := rescaleSubjects(subjects, tt.oldAmt, tt.newAmt); err != nil {
+				t.Fatalf("rescaleSubjects: %v", err)
+			}
+			for i, s := range subjects {
+				if s.TaxAmt != tt.want[i] || s.FactTaxAmt != tt.want[i] {
+					t.Errorf("税目%d: TaxAmt=%s FactTaxAmt=%s, want %s", i, s.TaxAmt, s.FactTaxAmt, tt.want[i])
+				}
+				if s.ExpTaxAmt != "" {
+					t.Errorf("税目%d: 空的ExpTaxAmt不应被填充: %s", i, s.ExpTaxAmt)
+				}
+			}
+		})
+	}
+
+	if err := rescaleSubjects([]SubjectList7211{{TaxAmt: "abc"}}, "1.00", "2.00"); err == nil {
+		t.Errorf("税目金额不合法时应返回错误")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"golang.org/x/text/encoding/simplifiedchinese"
 	"io"
 	"net/http"
 	"strings"
@@ -25,6 +24,8 @@ type CFMQClient struct {
 	Token        string
 	SedQueueTips string
 	SedQueueCtbs string
+	TipsCharset  string // 发往tips队列的报文字符集
+	CtbsCharset  string // 发往ctbs队列的报文字符集
 }
 
 type CFMQResponse struct {
@@ -77,12 +78,18 @@ func (c *CFMQClient) CreateQueue(queueName string) error {
 
 func (c *CFMQClient) SendMsg(msg string, bookOrgCode string) error {
 	AppLogger.Printf("[CFMQ] sending message: %s", msg)
+	encodedMsg, err := EncodeXMLString(msg, charsetOrDefault(c.CtbsCharset, CharsetUTF8))
+	if err != nil {
+		AppLogger.Printf("[CFMQ] Error encoding message: %s", err)
+		return err
+	}
+
 	headers := make(map[string]string)
 	headers[TOKEN] = c.Token
 	headers[DESTINATION] = c.SedQueueCtbs
 	headers["Content-Type"] = "text/plain"
 	headers[BOOKORG] = bookOrgCode
-	res, err := doHttpRequestWithBody(c.ServerUrl+"/queue/send", headers, msg)
+	res, err := doHttpRequestWithBody(c.ServerUrl+"/queue/send", headers, encodedMsg)
 	if err != nil {
 		AppLogger.Printf("[CFMQ] Error sending message: %s", err)
 		return err
@@ -95,9 +102,10 @@ func (c *CFMQClient) SendMsg(msg string, bookOrgCode string) error {
 }
 
 func (c *CFMQClient) SendTipsMsg(msg string, treCode string) error {
-	gbkMsg, err := encodeToGBK(msg)
+	charset := charsetOrDefault(c.TipsCharset, DefaultCharset)
+	encodedMsg, err := EncodeXMLString(msg, charset)
 	if err != nil {
-		AppLogger.Printf("[CFMQ] Error encoding message to GBK: %s", err)
+		AppLogger.Printf("[CFMQ] Error encoding message to %s: %s", charset, err)
 		return err
 	}
 
@@ -108,7 +116,7 @@ func (c *CFMQClient) SendTipsMsg(msg string, treCode string) error {
 	headers[DESTINATION] = c.SedQueueTips
 	//headers["Content-Type"] = "text/plain"
 	headers[TREASURY] = treCode
-	res, err := doHttpRequestWithBody(c.ServerUrl+"/queue/send", headers, gbkMsg)
+	res, err := doHttpRequestWithBody(c.ServerUrl+"/queue/send", headers, encodedMsg)
 	if err != nil {
 		AppLogger.Printf("[CFMQ] Error sending message: %s", err)
 		return err
@@ -120,16 +128,6 @@ func (c *CFMQClient) SendTipsMsg(msg string, treCode string) error {
 	return nil
 }
 
-// encodeToGBK 将UTF-8字符串转换为GBK编码
-func encodeToGBK(utf8Str string) (string, error) {
-	encoder := simplifiedchinese.GBK.NewEncoder()
-	gbkBytes, err := encoder.String(utf8Str)
-	if err != nil {
-		return "", err
-	}
-	return gbkBytes, nil
-}
-
 func (c *CFMQClient) HeartBeat(ctx context.Context) {
 	for {
 		select {
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 支持的字符集名称
+const (
+	CharsetUTF8    = "UTF-8"
+	CharsetGBK     = "GBK"
+	CharsetGB18030 = "GB18030"
+)
+
+// DefaultCharset 未配置时的默认输出字符集（与历史行为保持一致）
+const DefaultCharset = CharsetGBK
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// xmlDeclEncodingRegexp 匹配XML声明中的encoding属性
+var xmlDeclEncodingRegexp = regexp.MustCompile(`^(\s*<\?xml[^>]*?encoding\s*=\s*["'])([^"']*)(["'])`)
+
+// xmlDeclRegexp 匹配XML声明
+var xmlDeclRegexp = regexp.MustCompile(`^\s*<\?xml[^>]*\?>`)
+
+// NormalizeCharset 规范化字符集名称，不支持的字符集返回空串
+func NormalizeCharset(name string) string {
+	switch strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), "_", "-")) {
+	case "UTF-8", "UTF8":
+		return CharsetUTF8
+	case "GBK", "CP936", "GB2312", "GB-2312":
+		return CharsetGBK
+	case "GB18030", "GB-18030":
+		return CharsetGB18030
+	default:
+		return ""
+	}
+}
+
+// CharsetCCSID 字符集对应的MQ CCSID，用于MQMD/RFH2的CodedCharSetId
+func CharsetCCSID(charset string) string {
+	switch NormalizeCharset(charset) {
+	case CharsetUTF8:
+		return "1208"
+	case CharsetGB18030:
+		return "54936"
+	default:
+		return "1386"
+	}
+}
+
+// charsetOrDefault 返回规范化后的字符集，为空或不支持时返回默认值
+func charsetOrDefault(name, defaultCharset string) string {
+	if charset := NormalizeCharset(name); charset != "" {
+		return charset
+	}
+	return defaultCharset
+}
+
+// decoderEncoding 获取解码用的编码
+// GBK 使用 GB18030 解码：GB18030 兼容 GBK，可以容忍声明为GBK但包含生僻字四字节编码的文件
+func decoderEncoding(charset string) (encoding.Encoding, error) {
+	switch NormalizeCharset(charset) {
+	case CharsetUTF8:
+		return unicode.UTF8BOM, nil
+	case CharsetGBK, CharsetGB18030:
+		return simplifiedchinese.GB18030, nil
+	default:
+		return nil, fmt.Errorf("不支持的字符集: %s", charset)
+	}
+}
+
+// encoderEncoding 获取编码用的编码
+func encoderEncoding(charset string) (encoding.Encoding, error) {
+	switch NormalizeCharset(charset) {
+	case CharsetUTF8:
+		return unicode.UTF8, nil
+	case CharsetGBK:
+		return simplifiedchinese.GBK, nil
+	case CharsetGB18030:
+		return simplifiedchinese.GB18030, nil
+	default:
+		return nil, fmt.Errorf("不支持的字符集: %s", charset)
+	}
+}
+
+// declaredCharset 读取XML声明中的encoding，无声明时返回空串
+func declaredCharset(data []byte) string {
+	head := data
+	if len(head) > 256 {
+		head = head[:256]
+	}
+	head = bytes.TrimPrefix(head, utf8BOM)
+	match := xmlDeclEncodingRegexp.FindSubmatch(head)
+	if match == nil {
+		return ""
+	}
+	return string(match[2])
+}
+
+// DetectCharset 检测XML字节数据的字符集
+// 优先级：UTF-8 BOM > XML声明 > 是否为合法UTF-8 > GB18030
+func DetectCharset(data []byte) string {
+	if bytes.HasPrefix(data, utf8BOM) {
+		return CharsetUTF8
+	}
+	if declared := declaredCharset(data); declared != "" {
+		if charset := NormalizeCharset(declared); charset != "" {
+			return charset
+		}
+	}
+	if utf8.Valid(data) {
+		return CharsetUTF8
+	}
+	return CharsetGB18030
+}
+
+// DecodeXMLBytes 按检测到的字符集把XML字节数据解码为UTF-8字符串，同时返回检测到的字符集
+func DecodeXMLBytes(data []byte) (string, string, error) {
+	if declared := declaredCharset(data); declared != "" && NormalizeCharset(declared) == "" {
+		return "", "", fmt.Errorf("不支持的字符集: %s", declared)
+	}
+	charset := DetectCharset(data)
+	// 声明为UTF-8但实际为GBK等编码的文件，解码会把中文替换成U+FFFD，直接报错
+	if charset == CharsetUTF8 && !utf8.Valid(bytes.TrimPrefix(data, utf8BOM)) {
+		return "", "", fmt.Errorf("文件声明为UTF-8，但内容不是合法的UTF-8编码")
+	}
+	enc, err := decoderEncoding(charset)
+	if err != nil {
+		return "", "", err
+	}
+	utf8Data, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("%s解码失败: %v", charset, err)
+	}
+	return string(utf8Data), charset, nil
+}
+
+// EncodeXMLString 把UTF-8字符串编码为指定字符集，并同步改写XML声明中的encoding
+func EncodeXMLString(content, charset string) (string, error) {
+	enc, err := encoderEncoding(charset)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := enc.NewEncoder().String(setXMLDeclEncoding(content, NormalizeCharset(charset)))
+	if err != nil {
+		return "", fmt.Errorf("%s编码失败: %v", NormalizeCharset(charset), err)
+	}
+	return encoded, nil
+}
+
+// setXMLDeclEncoding 改写XML声明中的encoding属性，声明中没有encoding时补充，没有声明时原样返回
+func setXMLDeclEncoding(content, charset string) string {
+	if xmlDeclEncodingRegexp.MatchString(content) {
+		return xmlDeclEncodingRegexp.ReplaceAllString(content, "${1}"+charset+"${3}")
+	}
+	loc := xmlDeclRegexp.FindStringIndex(content)
+	if loc == nil {
+		return content
+	}
+	decl := content[loc[0]:loc[1]]
+	decl = strings.TrimSuffix(decl, "?>")
+	decl = strings.TrimRight(decl, " ") + ` encoding="` + charset + `"?>`
+	return content[:loc[0]] + decl + content[loc[1]:]
+}
+
+// utf8CharsetReader 用于已解码为UTF-8的内容：忽略XML声明中的encoding，直接按UTF-8读取
+func utf8CharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if NormalizeCharset(charset) == "" {
+		return nil, fmt.Errorf("不支持的字符集: %s", charset)
+	}
+	return input, nil
+}
+
+// unmarshalXMLString 解析已解码为UTF-8的XML字符串
+func unmarshalXMLString(content string, v any) error {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.CharsetReader = utf8CharsetReader
+	return decoder.Decode(v)
+}
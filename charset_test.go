@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// encodeTest 把UTF-8字符串编码为GBK/GB18030字节，用于构造测试报文
+func encodeTest(t *testing.T, charset, s string) []byte {
+	t.Helper()
+	enc, err := encoderEncoding(charset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDetectCharset(t *testing.T) {
+	gbkName, _ := simplifiedchinese.GBK.NewEncoder().String("张三")
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"UTF-8 BOM", "\ufeff<?xml version=\"1.0\" encoding=\"GBK\"?><CFX/>", CharsetUTF8},
+		{"声明GBK", `<?xml version="1.0" encoding="gbk"?><CFX/>`, CharsetGBK},
+		{"声明GB2312按GBK处理", `<?xml version="1.0" encoding="GB2312"?><CFX/>`, CharsetGBK},
+		{"声明GB18030", `<?xml version='1.0' encoding='GB18030'?><CFX/>`, CharsetGB18030},
+		{"无声明合法UTF-8", "<CFX>张三</CFX>", CharsetUTF8},
+		{"无声明GBK字节", "<CFX>" + gbkName + "</CFX>", CharsetGB18030},
+	}
+	for _, tt := range tests {
+		if got := DetectCharset([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: DetectCharset = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeXMLBytes(t *testing.T) {
+	// 㐀 在GB18030中为四字节编码，GBK中没有
+	gbk := append([]byte(`<?xml version="1.0" encoding="GBK"?><CFX>`), encodeTest(t, CharsetGBK, "张三")...)
+	gb18030 := append([]byte(`<?xml version="1.0" encoding="GB18030"?><CFX>`), encodeTest(t, CharsetGB18030, "刘㐀")...)
+	mismatch := append([]byte(`<?xml version="1.0" encoding="UTF-8"?><CFX>`), encodeTest(t, CharsetGBK, "张三")...)
+	tests := []struct {
+		name        string
+		data        []byte
+		wantContent string
+		wantCharset string
+		wantErr     bool
+	}{
+		{"GBK", append(gbk, "</CFX>"...), "张三", CharsetGBK, false},
+		{"GB18030四字节", append(gb18030, "</CFX>"...), "刘㐀", CharsetGB18030, false},
+		{"UTF-8 BOM", []byte("\ufeff<?xml version=\"1.0\" encoding=\"UTF-8\"?><CFX>张三</CFX>"), "张三", CharsetUTF8, false},
+		{"声明UTF-8实际GBK", append(mismatch, "</CFX>"...), "", "", true},
+		{"不支持的字符集", []byte(`<?xml version="1.0" encoding="BIG5"?><CFX/>`), "", "", true},
+	}
+	for _, tt := range tests {
+		content, charset, err := DecodeXMLBytes(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if charset != tt.wantCharset {
+			t.Errorf("%s: charset = %s, want %s", tt.name, charset, tt.wantCharset)
+		}
+		if strings.HasPrefix(content, "\ufeff") || strings.Contains(content, "�") {
+			t.Errorf("%s: content = %q", tt.name, content)
+		}
+		if !strings.Contains(content, tt.wantContent) {
+			t.Errorf("%s: content = %q, want %q", tt.name, content, tt.wantContent)
+		}
+	}
+}
+
+func TestEncodeXMLStringRoundTrip(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?><CFX><Name>张三 &amp; 刘㐀</Name></CFX>`
+	for _, charset := range []string{CharsetUTF8, CharsetGB18030, "gb18030"} {
+		encoded, err := EncodeXMLString(content, charset)
+		if err != nil {
+			t.Fatalf("%s: %v", charset, err)
+		}
+		decoded, detected, err := DecodeXMLBytes([]byte(encoded))
+		if err != nil {
+			t.Fatalf("%s: %v", charset, err)
+		}
+		if detected != NormalizeCharset(charset) {
+			t.Errorf("%s: detected = %s", charset, detected)
+		}
+		if want := strings.Replace(content, "UTF-8", NormalizeCharset(charset), 1); decoded != want {
+			t.Errorf("%s: round trip = %q, want %q", charset, decoded, want)
+		}
+	}
+
+	// GBK无法表示的字符报错，而不是输出问号
+	if _, err := EncodeXMLString(content, CharsetGBK); err == nil {
+		t.Error("GBK编码四字节字符应报错")
+	}
+	noEncoding, err := EncodeXMLString(`<?xml version="1.0"?><CFX/>`, CharsetGBK)
+	if err != nil || noEncoding != `<?xml version="1.0" encoding="GBK"?><CFX/>` {
+		t.Errorf("补充encoding = %q, %v", noEncoding, err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FixedClockLayout 固定业务时钟的配置格式
+const FixedClockLayout = "20060102150405"
+
+var (
+	clockLock  sync.RWMutex
+	fixedClock *time.Time // 不为nil时业务时钟固定为该时间
+)
+
+// BusinessNow 返回业务时钟的当前时间，转换过程中的日期、时间都应从这里获取
+func BusinessNow() time.Time {
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+
+	if fixedClock != nil {
+		return *fixedClock
+	}
+	return time.Now()
+}
+
+// SetFixedClock 固定业务时钟
+func SetFixedClock(t time.Time) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	fixedClock = &t
+}
+
+// ResetClock 恢复为系统时钟
+func ResetClock() {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	fixedClock = nil
+}
+
+// ConfigureDeterministic 按配置设置确定性转换模式
+// 开启时业务时钟固定为FixedClock，ID生成器按IdSeed重新播种，相同输入每次运行得到完全相同的输出
+// 每次转换运行开始时调用一次，两种模式下都会重置ID生成器的时间戳和序列号
+func ConfigureDeterministic(setting *Setting) error {
+	if !setting.Deterministic {
+		ResetClock()
+		defaultGenerator.SetRealtime()
+		return nil
+	}
+
+	clock, err := time.ParseInLocation(FixedClockLayout, setting.FixedClock, time.Local)
+	if err != nil {
+		return fmt.Errorf("确定性模式的固定时钟[%s]格式应为%s: %v", setting.FixedClock, FixedClockLayout, err)
+	}
+	SetFixedClock(clock)
+	defaultGenerator.SetDeterministic(clock, setting.IdSeed)
+	AppLogger.Printf("确定性转换模式: 业务时钟 %s, ID种子 %d", setting.FixedClock, setting.IdSeed)
+	return nil
+}
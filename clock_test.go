@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+// writeTestCFX 将报文结构写入临时XML文件
+func writeTestCFX(t *testing.T, name string, cfx *CFX) string {
+	t.Helper()
+	content, err := xml.Marshal(cfx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeTestFile(t, name, `<?xml version="1.0" encoding="UTF-8"?>`+string(content))
+}
+
+func TestDeterministicOutputIsByteIdentical(t *testing.T) {
+	defer ConfigureDeterministic(&Setting{})
+	defer func(charset string) { outputCharset = charset }(outputCharset)
+
+	files := []string{
+		writeTestCFX(t, "7221.xml", new7221TestCFX(3)),
+		writeTestCFX(t, "6100.xml", new6100TestCFX("A01", "1.00", "2.00")),
+	}
+	run := func(seed int64) []string {
+		setting := &Setting{Deterministic: true, FixedClock: "20250102030405", IdSeed: seed}
+		if err := ConfigureDeterministic(setting); err != nil {
+			t.Fatal(err)
+		}
+		if err := ConfigureConversion(setting); err != nil {
+			t.Fatal(err)
+		}
+		var bodies []string
+		for _, file := range files {
+			outputs, err := ConvertMsg(file, setting)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, output := range outputs {
+				envelope, err := json.Marshal(NewEnvelopeRecord(file, output))
+				if err != nil {
+					t.Fatal(err)
+				}
+				bodies = append(bodies, string(envelope), output.Body)
+			}
+		}
+		return bodies
+	}
+
+	first, second := run(42), run(42)
+	if len(first) != 4 {
+		t.Fatalf("%d个输出, want 4", len(first)/2)
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("相同种子的第%d个输出不一致:\n%s\n%s", i, first[i], second[i])
+		}
+	}
+	if cfx := parseOutputCFX(t, first[1]); cfx.HEAD.WorkDate != "20250102" {
+		t.Errorf("WorkDate = %s, want 业务时钟日期20250102", cfx.HEAD.WorkDate)
+	}
+	if other := run(43); other[1] == first[1] {
+		t.Error("不同种子应生成不同的ID")
+	}
+
+	if err := ConfigureDeterministic(&Setting{Deterministic: true, FixedClock: "2025-01-02"}); err == nil {
+		t.Error("固定时钟格式错误应报错")
+	}
+}
@@ -3,11 +3,10 @@ package main
 import (
 	"encoding/xml"
 	"fmt"
-	"golang.org/x/text/encoding/simplifiedchinese"
 	"io/ioutil"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // CFX 结构体定义XML根元素
@@ -44,6 +43,9 @@ type MSG struct {
 	BatchHead7211   *BatchHead7211   `xml:"BatchHead7211,omitempty"`
 	TurnAccount7211 *TurnAccount7211 `xml:"TurnAccount7211,omitempty"`
 	TaxBody7211     *TaxBody7211     `xml:"TaxBody7211,omitempty"`
+
+	// 其他报文类型的消息体，由对应的转换器通过DecodeElement解析
+	Others []RawXMLElement `xml:",any"`
 }
 
 // BatchHead7221 7221 消息类型的结构体
@@ -177,69 +179,139 @@ type SubjectList7211 struct {
 
 // OutputData 结构体定义输出数据
 type OutputData struct {
-	Item1           string
-	Item2           string
-	Item3           string
-	Item4           string
-	Item5           string
-	Item6           string
-	Item7           string
-	Item8           string
+	MsgNo           string        // 报文编号
+	TipsHead        *TipsHeadInfo // TIPS报文头信息
+	MQMD            *MQMDInfo     // MQ消息描述符
+	RFH2            *RFH2Info     // MQ RFH2头信息
+	Body            string        // 按输出字符集编码后的报文
 	Detail7211Count int
 	Detail7221Count int
+
+	Cfx              *CFX              // 转换后的报文结构
+	Source           *CFX              // 源报文结构，用于对账
+	Variant          int               // 压测放大的副本序号，0为原报文
+	SourceRefs       []SourceRef       // 明细的源标识，与输出报文中的明细按顺序一一对应
+	ValidationErrors []ValidationError // 校验错误，不为空时报文不会被发送
+
+	passThrough *passThroughSource // 透传模式下对应的源报文，为nil时按报文结构生成
 }
 
 // 全局变量
 var (
-	payeeOpBkCode string
-	totalCounts   int
+	payeeOpBkCode   string
+	outputCharset   string
+	split7221Size   int
+	split7211Size   int
+	groupKeys7211   = []string{DefaultGroupKey7211}
+	recomputeTotals bool
+	passThrough     bool
+	prettyXML       bool
+	totalCounts     int
+	envelopeConfig  MQEnvelopeConfig
+	amplifyOptions  AmplifyOptions
+
+	fieldMapping7211 = defaultFieldMapping7211()
 )
 
-// ConvertMsg 读取并转换消息文件
-func ConvertMsg(filePath string, payeeOpBkCodeNew string) ([]*OutputData, error) {
-	// 检查文件名是否包含特定字符串
-	if strings.Contains(filePath, "_3190_") {
-		return nil, nil
+// DefaultSplitSize 单个报文的默认最大明细数
+const DefaultSplitSize = 1000
+
+// DefaultGroupKey7211 6100->7211默认的分组字段
+const DefaultGroupKey7211 = "TaxOrgCode"
+
+// ConfigureConversion 按配置设置报文转换参数，每次转换运行开始时调用一次
+func ConfigureConversion(setting *Setting) error {
+	if setting.OutputCharset != "" && NormalizeCharset(setting.OutputCharset) == "" {
+		return fmt.Errorf("不支持的输出字符集: %s", setting.OutputCharset)
+	}
+	groupKeys, err := ParseGroupKeys7211(setting.GroupKeys7211)
+	if err != nil {
+		return err
 	}
+	payeeOpBkCode = setting.PayeeOpBkCode
+	outputCharset = charsetOrDefault(setting.OutputCharset, DefaultCharset)
+	split7221Size = setting.Split7221Size
+	split7211Size = setting.Split7211Size
+	groupKeys7211 = groupKeys
+	recomputeTotals = setting.RecomputeTotals
+	passThrough = setting.PassThrough
+	prettyXML = setting.PrettyXML
+	envelopeConfig = NewMQEnvelopeConfig(setting)
+	amplifyOptions = NewAmplifyOptions(setting)
+	return nil
+}
 
-	// 读取文件内容（使用GBK编码）
-	gbkDecoder := simplifiedchinese.GBK.NewDecoder()
+// ConvertMsg 读取并转换消息文件，转换参数由ConfigureConversion预先设置
+func ConvertMsg(filePath string, setting *Setting) ([]*OutputData, error) {
 	fileContent, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("读取文件失败: %v", err)
 	}
 
-	// 将GBK编码转换为UTF-8
-	utf8Content, err := gbkDecoder.Bytes(fileContent)
+	// 按XML声明（或自动检测）的字符集转换为UTF-8
+	xmlContent, _, err := DecodeXMLBytes(fileContent)
 	if err != nil {
-		return nil, fmt.Errorf("GBK解码失败: %v", err)
+		return nil, err
 	}
 
-	// 在 xml.Unmarshal 之前添加以下代码来移除编码声明
-	xmlContent := string(utf8Content)
-	// 移除GBK编码声明，替换为UTF-8
-	xmlContent = strings.Replace(xmlContent, `encoding="GBK"`, `encoding="UTF-8"`, -1)
-	xmlContent = strings.Replace(xmlContent, `encoding="gbk"`, `encoding="UTF-8"`, -1)
-	xmlContent = strings.Replace(xmlContent, `encoding='GBK'`, `encoding='UTF-8'`, -1)
-	xmlContent = strings.Replace(xmlContent, `encoding='gbk'`, `encoding='UTF-8'`, -1)
-
 	// 解析XML
 	var cfx CFX
-	err = xml.Unmarshal([]byte(xmlContent), &cfx)
+	err = unmarshalXMLString(xmlContent, &cfx)
 	if err != nil {
 		return nil, fmt.Errorf("解析XML失败: %v", err)
 	}
 
-	payeeOpBkCode = payeeOpBkCodeNew
-	// 根据消息类型调用相应的转换函数
-	switch GetMsgType(&cfx) {
-	case "7221":
-		return Convert7221(&cfx)
-	case "6100":
-		return Convert6100To7211(&cfx)
-	default:
+	// 透传模式下在源报文原文上生成输出报文
+	sourceDocument = xmlContent
+
+	// 按报文编号过滤
+	if ok, reason := fileFilter.AllowMsgNo(GetMsgType(&cfx)); !ok {
+		AppLogger.Printf("跳过文件 %s: %s", filePath, reason)
 		return nil, nil
 	}
+
+	// 根据消息类型查找对应的转换器
+	msgType := GetMsgType(&cfx)
+	converter, ok := LookupConverter(msgType)
+	if !ok {
+		return nil, &UnsupportedMsgTypeError{MsgNo: msgType}
+	}
+	// 按源报文的基准日期计算业务日期平移天数
+	dateShifter.Begin(&cfx)
+	outputs, err := converter.Convert(&cfx)
+	if err != nil {
+		return nil, err
+	}
+	// 压测放大
+	outputs, err = Amplify(outputs, amplifyOptions)
+	if err != nil {
+		return nil, err
+	}
+	// 模板中引用的源报文同样需要脱敏
+	templateSource, err := dataMasker.MaskedCopy(&cfx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, output := range outputs {
+		// 存在用户模板时按模板重新生成报文
+		if err := msgTemplates.applyTemplate(output, templateSource); err != nil {
+			return nil, err
+		}
+		// 按字段覆盖规则修改报文，在模板之后执行，不会被模板覆盖
+		if _, err := overrideRules.Apply(output, setting); err != nil {
+			return nil, err
+		}
+		output.Source = &cfx
+		// 根据最终的报文头生成MQ信封信息
+		BuildEnvelope(output, envelopeConfig)
+		// 校验转换后的报文
+		if output.Cfx != nil {
+			output.ValidationErrors = validationRules.Validate(output.Cfx)
+			output.ValidationErrors = append(output.ValidationErrors, referenceData.Check(output.Cfx, filePath)...)
+		}
+	}
+	return outputs, nil
 }
 
 // GetMsgType 获取消息类型
@@ -258,54 +330,100 @@ func GetMsgType(cfx *CFX) string {
 }
 
 // Convert7221 转换7221消息类型
+// 明细数超过拆分阈值时拆分为多个报文，每个报文单独生成MsgID/PackNo并重新计算AllNum/AllAmt
 func Convert7221(cfx *CFX) ([]*OutputData, error) {
-	// 检查数量限制
-	allNum, _ := strconv.Atoi(cfx.MSG.BatchHead7221.AllNum)
-	if allNum > 1000 || len(cfx.MSG.DrawbackBody7221.DrawbackInfo7221) > 1000 {
-		return nil, fmt.Errorf("7221 all count > 1000, the app should be update the logic")
+	if cfx.MSG.BatchHead7221 == nil || cfx.MSG.DrawbackBody7221 == nil {
+		return nil, fmt.Errorf("7221报文缺少BatchHead7221或DrawbackBody7221")
+	}
+
+	chunkSize := split7221Size
+	if chunkSize <= 0 {
+		chunkSize = DefaultSplitSize
+	}
+
+	infos := cfx.MSG.DrawbackBody7221.DrawbackInfo7221
+	if len(infos) <= chunkSize {
+		data, err := doConvert7221(cfx, infos, 0, false)
+		if err != nil {
+			return nil, err
+		}
+		return []*OutputData{data}, nil
+	}
+
+	AppLogger.Printf("7221明细数[%d]超过拆分阈值[%d]，拆分为多个报文", len(infos), chunkSize)
+	var result []*OutputData
+	for start := 0; start < len(infos); start += chunkSize {
+		end := start + chunkSize
+		if end > len(infos) {
+			end = len(infos)
+		}
+		data, err := doConvert7221(cfx, infos[start:end], start, true)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data)
 	}
+	return result, nil
+}
 
+// doConvert7221 根据一组7221明细生成一个7221报文，start为第一条明细在源报文中的下标
+// recompute为true时根据明细重新计算AllNum/AllAmt
+func doConvert7221(cfx *CFX, infos []DrawbackInfo7221, start int, recompute bool) (*OutputData, error) {
 	msgid := GenerateUniqueTipsId()
 
 	data := &OutputData{}
-	data.Item4 = "7221"
-	data.Item5 = BuildItem5(data.Item4, msgid)
-	data.Item6 = BuildItem6()
-	data.Item7 = BuildItem7(data.Item4)
 
 	detail7221Count := 0
 
+	allNum := cfx.MSG.BatchHead7221.AllNum
+	allAmt := cfx.MSG.BatchHead7221.AllAmt
+	if recompute {
+		var totalAmt Amount
+		for _, info := range infos {
+			amt, err := ParseAmount(info.Amt)
+			if err != nil {
+				return nil, fmt.Errorf("7221明细TraNo[%s]金额错误: %v", info.TraNo, err)
+			}
+			totalAmt += amt
+		}
+		allNum = strconv.Itoa(len(infos))
+		allAmt = totalAmt.String()
+	}
+
 	// 构建新的CFX结构
 	newCfx := CFX{
 		HEAD: HEAD{
 			VER:      cfx.HEAD.VER,
 			SRC:      cfx.HEAD.SRC,
-			DES:      "333333333333",
+			DES:      defaultEnvironment.DES,
 			APP:      cfx.HEAD.APP,
 			MsgNo:    cfx.HEAD.MsgNo,
 			MsgID:    msgid,
 			MsgRef:   msgid,
-			WorkDate: time.Now().Format("20060102"),
+			WorkDate: BusinessDate(),
 		},
 		MSG: MSG{
 			BatchHead7221: &BatchHead7221{
 				TaxOrgCode:      cfx.MSG.BatchHead7221.TaxOrgCode,
-				EntrustDate:     cfx.MSG.BatchHead7221.EntrustDate,
+				EntrustDate:     dateShifter.ShiftBusinessDate(cfx.MSG.BatchHead7221.EntrustDate),
 				PackNo:          GeneratePackNo(),
 				DrawBackTreCode: cfx.MSG.BatchHead7221.DrawBackTreCode,
 				ReckStyle:       cfx.MSG.BatchHead7221.ReckStyle,
-				AllNum:          cfx.MSG.BatchHead7221.AllNum,
-				AllAmt:          cfx.MSG.BatchHead7221.AllAmt,
+				AllNum:          allNum,
+				AllAmt:          allAmt,
 			},
 		},
 	}
+	// 选择了目标环境时按环境设置节点代码
+	environment.ApplyHead(&newCfx.HEAD)
 
 	// 创建DrawbackBody7221
 	drawbackBody := &DrawbackBody7221{}
-	for _, info := range cfx.MSG.DrawbackBody7221.DrawbackInfo7221 {
+
+	for _, info := range infos {
 		drawbackInfo := DrawbackInfo7221{
 			TraNo:              info.TraNo,
-			BillDate:           info.BillDate,
+			BillDate:           dateShifter.Shift(info.BillDate),
 			VouNo:              info.VouNo,
 			Amt:                info.Amt,
 			BdgLevel:           info.BdgLevel,
@@ -329,173 +447,399 @@ func Convert7221(cfx *CFX) ([]*OutputData, error) {
 		}
 
 		drawbackBody.DrawbackInfo7221 = append(drawbackBody.DrawbackInfo7221, drawbackInfo)
+		data.SourceRefs = append(data.SourceRefs, SourceRef{
+			MsgID:  cfx.HEAD.MsgID,
+			PackNo: cfx.MSG.BatchHead7221.PackNo,
+			TraNo:  info.TraNo,
+		})
 		totalCounts++
 		detail7221Count++
 	}
 
 	newCfx.MSG.DrawbackBody7221 = drawbackBody
 
+	// 校验总笔数和总金额
+	if err := checkBatchTotals(&newCfx, recomputeTotals); err != nil {
+		return nil, err
+	}
+
+	// 脱敏
+	dataMasker.MaskCFX(&newCfx)
+
+	data.Detail7221Count = detail7221Count
+	data.Cfx = &newCfx
+
+	// 透传模式在源报文原文上生成报文
+	if data.passThrough = newPassThroughSource(start, len(infos)); data.passThrough != nil {
+		if err := renderPassThrough(data, dataMasker); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
 	// 生成XML字符串
 	outputXML, err := generateXMLString(newCfx)
 	if err != nil {
 		return nil, err
 	}
+	data.Body = outputXML
+	return data, nil
+}
 
-	data.Item8 = outputXML
-	data.Detail7221Count = detail7221Count
-	result := []*OutputData{data}
+// Convert7211 重放7211消息类型：重新生成MsgID、PackNo、FundSrlNo、TraNo、TaxVouNo，按需平移日期、拆分，缴款和税票明细保持不变
+func Convert7211(cfx *CFX) ([]*OutputData, error) {
+	if cfx.MSG.BatchHead7211 == nil || cfx.MSG.TaxBody7211 == nil {
+		return nil, fmt.Errorf("7211报文缺少BatchHead7211或TaxBody7211")
+	}
+
+	chunkSize := split7211Size
+	if chunkSize <= 0 {
+		chunkSize = DefaultSplitSize
+	}
+
+	infos := cfx.MSG.TaxBody7211.TaxInfo7211
+	if len(infos) <= chunkSize {
+		data, err := doConvert7211(cfx, infos, 0, false)
+		if err != nil {
+			return nil, err
+		}
+		return []*OutputData{data}, nil
+	}
+
+	AppLogger.Printf("7211明细数[%d]超过拆分阈值[%d]，拆分为多个报文", len(infos), chunkSize)
+	var result []*OutputData
+	for start := 0; start < len(infos); start += chunkSize {
+		end := start + chunkSize
+		if end > len(infos) {
+			end = len(infos)
+		}
+		data, err := doConvert7211(cfx, infos[start:end], start, true)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data)
+	}
 	return result, nil
 }
 
+// doConvert7211 根据一组7211明细生成一个7211报文，start为第一条明细在源报文中的下标
+// recompute为true时根据明细重新计算AllNum/AllAmt
+func doConvert7211(cfx *CFX, infos []TaxInfo7211, start int, recompute bool) (*OutputData, error) {
+	msgid := GenerateUniqueTipsId()
+
+	data := &OutputData{}
+
+	allNum := cfx.MSG.BatchHead7211.AllNum
+	allAmt := cfx.MSG.BatchHead7211.AllAmt
+	if recompute {
+		var totalAmt Amount
+		for _, info := range infos {
+			amt, err := ParseAmount(info.Payment7211.TraAmt)
+			if err != nil {
+				return nil, fmt.Errorf("7211明细TraNo[%s]金额错误: %v", info.Payment7211.TraNo, err)
+			}
+			totalAmt += amt
+		}
+		allNum = len(infos)
+		allAmt = totalAmt.String()
+	}
+
+	// 构建新的CFX结构
+	newCfx := CFX{
+		HEAD: HEAD{
+			VER:      cfx.HEAD.VER,
+			SRC:      cfx.HEAD.SRC,
+			DES:      defaultEnvironment.DES,
+			APP:      cfx.HEAD.APP,
+			MsgNo:    cfx.HEAD.MsgNo,
+			MsgID:    msgid,
+			MsgRef:   msgid,
+			WorkDate: BusinessDate(),
+		},
+		MSG: MSG{
+			BatchHead7211: &BatchHead7211{
+				TaxOrgCode:  cfx.MSG.BatchHead7211.TaxOrgCode,
+				EntrustDate: dateShifter.ShiftBusinessDate(cfx.MSG.BatchHead7211.EntrustDate),
+				PackNo:      GeneratePackNo(),
+				AllNum:      allNum,
+				AllAmt:      allAmt,
+			},
+		},
+	}
+	// 选择了目标环境时按环境设置节点代码
+	environment.ApplyHead(&newCfx.HEAD)
+	if cfx.MSG.TurnAccount7211 != nil {
+		turnAccount := *cfx.MSG.TurnAccount7211
+		turnAccount.FundSrlNo = GenerateUniqueId()
+		newCfx.MSG.TurnAccount7211 = &turnAccount
+	}
+
+	// 明细按原样复制，只重新生成流水号、税票号，平移开票日期、限缴日期和税款所属期
+	taxBody := &TaxBody7211{}
+	for _, info := range infos {
+		taxInfo := info
+		taxInfo.Payment7211.TraNo = GenerateTraNo()
+		taxInfo.TaxVou7211.TaxVouNo = GenerateTaxVouNo()
+		taxInfo.TaxVou7211.BillDate = dateShifter.Shift(info.TaxVou7211.BillDate)
+		taxInfo.TaxType7211.LimitDate = dateShifter.Shift(info.TaxType7211.LimitDate)
+		taxInfo.TaxType7211.TaxStartDate = dateShifter.Shift(info.TaxType7211.TaxStartDate)
+		taxInfo.TaxType7211.TaxEndDate = dateShifter.Shift(info.TaxType7211.TaxEndDate)
+		taxInfo.TaxType7211.SubjectList7211 = append([]SubjectList7211(nil), info.TaxType7211.SubjectList7211...)
+
+		taxBody.TaxInfo7211 = append(taxBody.TaxInfo7211, taxInfo)
+		data.SourceRefs = append(data.SourceRefs, SourceRef{
+			MsgID:  cfx.HEAD.MsgID,
+			PackNo: cfx.MSG.BatchHead7211.PackNo,
+			TraNo:  info.Payment7211.TraNo,
+		})
+		totalCounts++
+	}
+	newCfx.MSG.TaxBody7211 = taxBody
+
+	// 校验总笔数和总金额
+	if err := checkBatchTotals(&newCfx, recomputeTotals); err != nil {
+		return nil, err
+	}
+
+	// 脱敏
+	dataMasker.MaskCFX(&newCfx)
+
+	data.Detail7211Count = len(infos)
+	data.Cfx = &newCfx
+
+	// 透传模式在源报文原文上生成报文
+	if data.passThrough = newPassThroughSource(start, len(infos)); data.passThrough != nil {
+		if err := renderPassThrough(data, dataMasker); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	// 生成XML字符串
+	outputXML, err := generateXMLString(newCfx)
+	if err != nil {
+		return nil, err
+	}
+	data.Body = outputXML
+	return data, nil
+}
+
 // Convert6100To7211 转换6100到7211消息类型
 func Convert6100To7211(cfx *CFX) ([]*OutputData, error) {
+	if cfx.MSG.TaxHead6100 == nil || cfx.MSG.TaxBody6100 == nil {
+		return nil, fmt.Errorf("6100报文缺少TaxHead6100或TaxBody6100")
+	}
 	var result []*OutputData
 
-	// 按TaxOrgCode分组处理
-	taxOrgGroups := make(map[string][]TaxBill6100)
+	// 按分组字段分组，分组键排序后依次处理，组内保持源报文中的明细顺序，保证输出顺序稳定
+	groups := make(map[string][]TaxBill6100)
+	var groupKeys []string
 	for _, bill := range cfx.MSG.TaxBody6100.TaxBill6100 {
-		taxOrgGroups[bill.TaxOrgCode] = append(taxOrgGroups[bill.TaxOrgCode], bill)
+		key := groupKey6100(cfx.MSG.TaxHead6100, &bill, groupKeys7211)
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], bill)
 	}
+	sort.Strings(groupKeys)
 
-	// 如果有多个TaxOrgCode分组，分别处理
-	if len(taxOrgGroups) > 1 {
-		for taxOrgCode, bills := range taxOrgGroups {
-			// 创建新的CFX结构
-			newCfx := CFX{
-				MSG: MSG{
-					TaxHead6100: cfx.MSG.TaxHead6100,
-					TaxBody6100: &TaxBody6100{
-						TaxBill6100: bills,
-					},
+	if len(groupKeys) > 1 {
+		AppLogger.Printf("6100明细按%v分为%d组", groupKeys7211, len(groupKeys))
+	}
+	for _, key := range groupKeys {
+		// 创建新的CFX结构
+		newCfx := CFX{
+			HEAD: cfx.HEAD,
+			MSG: MSG{
+				TaxHead6100: cfx.MSG.TaxHead6100,
+				TaxBody6100: &TaxBody6100{
+					TaxBill6100: groups[key],
 				},
-			}
+			},
+		}
 
-			// 处理单个分组
-			groupResults := doConvert6100To7211(&newCfx, taxOrgCode)
-			result = append(result, groupResults...)
+		// 处理单个分组
+		groupResults, err := doConvert6100To7211(&newCfx, key)
+		if err != nil {
+			return nil, err
 		}
-		return result, nil
-	} else {
-		// 单个分组处理
-		return doConvert6100To7211(cfx, ""), nil
+		result = append(result, groupResults...)
 	}
+	return result, nil
+}
+
+// groupKey6100 按分组字段生成6100明细的分组键，多个字段以"|"连接
+func groupKey6100(head *TaxHead6100, bill *TaxBill6100, fields []string) string {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		values[i] = sourceFieldValue6100(field, head, bill)
+	}
+	return strings.Join(values, "|")
+}
+
+// ParseGroupKeys7211 解析6100->7211的分组字段，为空时默认按TaxOrgCode分组
+// 7211批次头只有一个TaxOrgCode，未配置TaxOrgCode时自动作为第一个分组字段，保证同一批次的明细属于同一征收机关
+func ParseGroupKeys7211(fields []string) ([]string, error) {
+	keys := []string{DefaultGroupKey7211}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !isSourceField6100(field) {
+			return nil, fmt.Errorf("6100分组字段 %s 不存在", field)
+		}
+		if field == DefaultGroupKey7211 {
+			continue
+		}
+		keys = append(keys, field)
+	}
+	return keys, nil
 }
 
 // doConvert6100To7211 实际执行6100到7211的转换
-func doConvert6100To7211(cfx *CFX, taxOrgCode string) []*OutputData {
+func doConvert6100To7211(cfx *CFX, groupKey string) ([]*OutputData, error) {
 	result := []*OutputData{}
+	chunkSize := split7211Size
+	if chunkSize <= 0 {
+		chunkSize = DefaultSplitSize
+	}
 	j := 1
 	n := 1
 
 	taxBody7211 := &TaxBody7211{}
 	total6100Detail := len(cfx.MSG.TaxBody6100.TaxBill6100)
-	var totalAmt float64
+	var totalAmt Amount
+	var firstBill *TaxBill6100
+	var sourceRefs []SourceRef
 
 	detail7211Count := 0
 	for _, body6100 := range cfx.MSG.TaxBody6100.TaxBill6100 {
-		amt, _ := strconv.ParseFloat(body6100.TaxAmt, 64)
+		amt, err := ParseAmount(body6100.TaxAmt)
+		if err != nil {
+			return nil, fmt.Errorf("6100明细ExpTaxVouNo[%s]金额错误: %v", body6100.ExpTaxVouNo, err)
+		}
 		totalAmt += amt
 
+		head := cfx.MSG.TaxHead6100
+		bill := &body6100
+		if n == 1 {
+			firstBill = bill
+		}
 		taxInfo7211 := TaxInfo7211{
 			Payment7211: Payment7211{
-				TraNo:        GenerateTraNo(),
-				TraAmt:       body6100.TaxAmt,
-				PayOpBnkNo:   "319376074422",
-				PayOpBnkName: "付款开户行名称",
-				HandOrgName:  "缴款单位名称",
-				PayAcct:      "9090313010010991008844",
+				TraNo:        fieldMapping7211.Value("TraNo", head, bill),
+				TraAmt:       fieldMapping7211.AmountValue("TraAmt", head, bill),
+				PayOpBnkNo:   fieldMapping7211.Value("PayOpBnkNo", head, bill),
+				PayOpBnkName: fieldMapping7211.Value("PayOpBnkName", head, bill),
+				HandOrgName:  fieldMapping7211.Value("HandOrgName", head, bill),
+				PayAcct:      fieldMapping7211.Value("PayAcct", head, bill),
 			},
 			TaxVou7211: TaxVou7211{
-				TaxVouNo:   GenerateTaxVouNo(),
-				BillDate:   time.Now().Format("20060102"),
-				TaxPayCode: "123508214908270504",
-				TaxPayName: "长汀县新桥中学",
-				BudgetType: body6100.BudgetType,
-				TrimSign:   body6100.TrimSign,
+				TaxVouNo:   fieldMapping7211.Value("TaxVouNo", head, bill),
+				BillDate:   fieldMapping7211.Value("BillDate", head, bill),
+				TaxPayCode: fieldMapping7211.Value("TaxPayCode", head, bill),
+				TaxPayName: fieldMapping7211.Value("TaxPayName", head, bill),
+				BudgetType: fieldMapping7211.Value("BudgetType", head, bill),
+				TrimSign:   fieldMapping7211.Value("TrimSign", head, bill),
 			},
 			TaxType7211: TaxType7211{
-				BudgetSubjectCode: body6100.BudgetSubjectCode,
-				LimitDate:         time.Now().Format("20060102"),
-				BudgetLevelCode:   body6100.BudgetLevelCode,
-				BudgetLevelName:   "省",
-				TaxStartDate:      time.Now().Format("20060102"),
-				TaxEndDate:        time.Now().Format("20060102"),
-				ViceSign:          body6100.ViceSign,
-				TaxType:           3,
-				HandBookKind:      3,
+				BudgetSubjectCode: fieldMapping7211.Value("BudgetSubjectCode", head, bill),
+				LimitDate:         fieldMapping7211.Value("LimitDate", head, bill),
+				BudgetLevelCode:   fieldMapping7211.Value("BudgetLevelCode", head, bill),
+				BudgetLevelName:   fieldMapping7211.Value("BudgetLevelName", head, bill),
+				TaxStartDate:      fieldMapping7211.Value("TaxStartDate", head, bill),
+				TaxEndDate:        fieldMapping7211.Value("TaxEndDate", head, bill),
+				ViceSign:          fieldMapping7211.Value("ViceSign", head, bill),
+				TaxType:           fieldMapping7211.IntValue("TaxType", head, bill),
+				HandBookKind:      fieldMapping7211.IntValue("HandBookKind", head, bill),
 				DetailNum:         1,
 				SubjectList7211: []SubjectList7211{
 					{
 						DetailNo:       1,
-						TaxSubjectCode: "11111111111111111111",
-						TaxSubjectName: "税目111",
-						TaxNumber:      "1",
-						TaxAmt:         body6100.TaxAmt,
-						TaxRate:        "1.00",
-						ExpTaxAmt:      body6100.TaxAmt,
-						DiscountTaxAmt: body6100.TaxAmt,
-						FactTaxAmt:     body6100.TaxAmt,
+						TaxSubjectCode: fieldMapping7211.Value("TaxSubjectCode", head, bill),
+						TaxSubjectName: fieldMapping7211.Value("TaxSubjectName", head, bill),
+						TaxNumber:      fieldMapping7211.Value("TaxNumber", head, bill),
+						TaxAmt:         fieldMapping7211.AmountValue("TaxAmt", head, bill),
+						TaxRate:        fieldMapping7211.Value("TaxRate", head, bill),
+						ExpTaxAmt:      fieldMapping7211.AmountValue("ExpTaxAmt", head, bill),
+						DiscountTaxAmt: fieldMapping7211.AmountValue("DiscountTaxAmt", head, bill),
+						FactTaxAmt:     fieldMapping7211.AmountValue("FactTaxAmt", head, bill),
 					},
 				},
 			},
 		}
 
 		taxBody7211.TaxInfo7211 = append(taxBody7211.TaxInfo7211, taxInfo7211)
+		sourceRefs = append(sourceRefs, SourceRef{
+			MsgID:       cfx.HEAD.MsgID,
+			ExpTaxVouNo: body6100.ExpTaxVouNo,
+		})
 		totalCounts++
 		detail7211Count++
 
-		// 每1000条记录或最后一条记录时生成一个输出
-		if j%1000 == 0 || total6100Detail == j {
+		// 每chunkSize条记录或最后一条记录时生成一个输出
+		if j%chunkSize == 0 || total6100Detail == j {
 			msgId := GenerateUniqueTipsId()
 
 			data := &OutputData{}
-			data.Item4 = "7211"
-			data.Item5 = BuildItem5(data.Item4, msgId)
-			data.Item6 = BuildItem6()
-			data.Item7 = BuildItem7(data.Item4)
 			data.Detail7211Count = detail7211Count
+			data.SourceRefs = sourceRefs
 
 			// 构建新的CFX结构
 			newCfx := CFX{
 				HEAD: HEAD{
-					VER:      "1.0",
-					SRC:      "100000000000",
-					DES:      "333333333333",
-					APP:      "TIPS",
+					VER:      defaultEnvironment.VER,
+					SRC:      defaultEnvironment.SRC,
+					DES:      defaultEnvironment.DES,
+					APP:      defaultEnvironment.APP,
 					MsgNo:    "7211",
 					MsgID:    msgId,
 					MsgRef:   msgId,
-					WorkDate: time.Now().Format("20060102"),
+					WorkDate: BusinessDate(),
 					Reserve:  "预留字段预留字段预留字段预留字段预留字段",
 				},
 				MSG: MSG{
 					BatchHead7211: &BatchHead7211{
-						TaxOrgCode:  getFirstTaxOrgCode(cfx),
-						EntrustDate: time.Now().Format("20060102"),
+						TaxOrgCode:  firstBill.TaxOrgCode, // 按TaxOrgCode分组，同一批次的明细TaxOrgCode相同
+						EntrustDate: BusinessDate(),
 						PackNo:      GeneratePackNo(),
 						AllNum:      n,
-						AllAmt:      fmt.Sprintf("%.2f", totalAmt),
+						AllAmt:      totalAmt.String(),
 					},
 					TurnAccount7211: &TurnAccount7211{
-						BizType:      0,
-						FundSrlNo:    GenerateUniqueId(),
-						PayBnkNo:     cfx.MSG.TaxHead6100.PayBkCode,
-						PayeeTreCode: cfx.MSG.TaxHead6100.TreCode,
-						PayeeTreName: "收款国库名称",
+						BizType:      fieldMapping7211.IntValue("BizType", cfx.MSG.TaxHead6100, firstBill),
+						FundSrlNo:    fieldMapping7211.Value("FundSrlNo", cfx.MSG.TaxHead6100, firstBill),
+						PayBnkNo:     fieldMapping7211.Value("PayBnkNo", cfx.MSG.TaxHead6100, firstBill),
+						PayeeTreCode: fieldMapping7211.Value("PayeeTreCode", cfx.MSG.TaxHead6100, firstBill),
+						PayeeTreName: fieldMapping7211.Value("PayeeTreName", cfx.MSG.TaxHead6100, firstBill),
 					},
 					TaxBody7211: taxBody7211,
 				},
 			}
+			// 选择了目标环境时按环境设置节点代码
+			environment.ApplyHead(&newCfx.HEAD)
+
+			// 校验总笔数和总金额
+			if err := checkBatchTotals(&newCfx, recomputeTotals); err != nil {
+				return nil, err
+			}
+
+			// 脱敏
+			dataMasker.MaskCFX(&newCfx)
 
 			// 生成XML字符串
 			outputXML, err := generateXMLString(newCfx)
-			if err == nil {
-				data.Item8 = outputXML
-				result = append(result, data)
+			if err != nil {
+				return nil, err
 			}
+			data.Body = outputXML
+			data.Cfx = &newCfx
+			result = append(result, data)
 
 			// 重置计数器和累计金额
 			taxBody7211 = &TaxBody7211{}
+			sourceRefs = nil
 			totalAmt = 0
 			n = 0
 			detail7211Count = 0
@@ -505,51 +849,25 @@ func doConvert6100To7211(cfx *CFX, taxOrgCode string) []*OutputData {
 		n++
 	}
 
-	return result
-}
-
-// getFirstTaxOrgCode 获取第一个TaxOrgCode
-func getFirstTaxOrgCode(cfx *CFX) string {
-	if len(cfx.MSG.TaxBody6100.TaxBill6100) > 0 {
-		return cfx.MSG.TaxBody6100.TaxBill6100[0].TaxOrgCode
-	}
-	return ""
+	return result, nil
 }
 
-// generateXMLString 生成格式化的XML字符串
+// generateXMLString 生成XML字符串并添加XML声明，按输出字符集编码
+// 默认不缩进、不换行，元素值和属性值原样保留；prettyXML为true时缩进输出，便于人工查看
 func generateXMLString(cfx CFX) (string, error) {
-	output, err := xml.MarshalIndent(cfx, "", "")
-	if err != nil {
-		return "", err
+	charset := charsetOrDefault(outputCharset, DefaultCharset)
+	declaration := `<?xml version="1.0" encoding="` + charset + `"?>`
+
+	var output []byte
+	var err error
+	if prettyXML {
+		output, err = xml.MarshalIndent(cfx, "", "  ")
+		declaration += "\n"
+	} else {
+		output, err = xml.Marshal(cfx)
 	}
-
-	// 转换为GBK编码
-	gbkEncoder := simplifiedchinese.GBK.NewEncoder()
-	gbkOutput, err := gbkEncoder.String(string(output))
 	if err != nil {
 		return "", err
 	}
-
-	// 移除换行符和空格并添加XML声明
-	cleanedOutput := strings.ReplaceAll(gbkOutput, "\n", "")
-	cleanedOutput = strings.ReplaceAll(cleanedOutput, "\r", "")
-	cleanedOutput = strings.ReplaceAll(cleanedOutput, " ", "")
-
-	return `<?xml version="1.0" encoding="GBK"?>` + cleanedOutput, nil
-}
-
-// BuildItem5 构建Item5字段
-func BuildItem5(msgType, msgId string) string {
-	return fmt.Sprintf("{\"SRC\":\"100000000000\",\"DES\":\"111111111111\",\"MsgNo\":\"%s\",\"MsgID\":\"%s\",\"MsgRef\":\"%s\",\"OriMsgNo\":\"\"}",
-		msgType, msgId, msgId)
-}
-
-// BuildItem6 构建Item6字段
-func BuildItem6() string {
-	return "{\"SourceQueue\":\"TIPS.GK200.INT.NORMAL.IN.TRANSLOG\",\"Persistence\":\"1\",\"CORRELID\":\"000000000000000000000000000000000000000000000000\",\"MSGID\":\"414D5120514D5F544950535F494E545FAD50C9664C80DB20\",\"UserIdentifier\":\"mqm\",\"Priority\":\"4\",\"Encoding\":\"273\",\"CodedCharSetId\":\"819\",\"Expiry\":\"-1\",\"PutDate\":\"2024.08.27\",\"PutTime\":\"14:36:20.130\",\"ReplyToQMgr\":\"QM_TIPS_INT_34\",\"ReplyToQ\":\"\",\"Report\":\"0\",\"Format\":\"MQHRF2\",\"ApplIdentityData\":\"\"}"
-}
-
-// BuildItem7 构建Item7字段
-func BuildItem7(msgType string) string {
-	return fmt.Sprintf("{\"Encoding\":\"273\",\"CodedCharSetId\":\"819\",\"Dlv\":\"UNKNOWN\",\"Pri\":\"UNKNOWN\",\"ISCURRCENTER\":\"UNKNOWN\",\"MSGFORMAT\":\"TIPS\",\"MSGFLAG\":\"NORMAL\",\"MSGORIFLAG\":\"UNKNOWN\",\"Flags\":\"0\",\"Format\":\"\",\"NameValueCCSID\":\"1208\",\"Version\":\"2\",\"APP\":\"TIPS\",\"CorrelationID\":\"524551000000000000000000000000000000000000000000\",\"DES\":\"111111111111\",\"DESTINATION\":\"GK200000002000\",\"EXCEPTIONMSG\":\"UNKNOWN\",\"EXCEPTIONTYPE\":\"UNKNOWN\",\"MSGDESC\":\"TIPS\",\"MSGTYPE\":\"MSG\",\"MsgID\":\"24082772110050119383\",\"MsgRef\":\"01610700000023848006\",\"ServiceId\":\"UNKNOWN\",\"ServiceId9120\":\"UNKNOWN\",\"TIPSTAGFLAG\":\"UNKNOWN\",\"TIPS_MSGNO\":\"UNKNOWN\",\"TIPS_ORIMSGNO\":\"UNKNOWN\",\"msgFormat\":\"TIPS\",\"msgReserve\":\"\",\"msgSrcAddr\":\"100000000000\",\"msgTarAddr\":\"111111111111\",\"msgType\":\"%s\",\"msgVer\":\"1.0\"}", msgType)
+	return EncodeXMLString(declaration+string(output), charset)
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// parseOutputCFX 解码并解析转换后的报文
+func parseOutputCFX(t *testing.T, body string) CFX {
+	t.Helper()
+	content, _, err := DecodeXMLBytes([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfx CFX
+	if err := unmarshalXMLString(content, &cfx); err != nil {
+		t.Fatal(err)
+	}
+	return cfx
+}
+
+// new7221TestCFX 构造明细金额为1.10、2.20……的7221报文
+func new7221TestCFX(n int) *CFX {
+	body := &DrawbackBody7221{}
+	total := 0
+	for i := 1; i <= n; i++ {
+		body.DrawbackInfo7221 = append(body.DrawbackInfo7221, DrawbackInfo7221{
+			TraNo:         fmt.Sprintf("T%d", i),
+			Amt:           fmt.Sprintf("%d.%d0", i, i),
+			PayeeOpBkCode: "SRC",
+		})
+		total += i*100 + i*10
+	}
+	return &CFX{
+		HEAD: HEAD{VER: "1.0", SRC: "1", APP: "TIPS", MsgNo: "7221"},
+		MSG: MSG{
+			BatchHead7221: &BatchHead7221{
+				TaxOrgCode: "A01",
+				AllNum:     fmt.Sprint(n),
+				AllAmt:     fmt.Sprintf("%d.%02d", total/100, total%100),
+			},
+			DrawbackBody7221: body,
+		},
+	}
+}
+
+func TestConvert7221Split(t *testing.T) {
+	defer func(size int, charset, bkCode string) {
+		split7221Size, outputCharset, payeeOpBkCode = size, charset, bkCode
+	}(split7221Size, outputCharset, payeeOpBkCode)
+	outputCharset, payeeOpBkCode = CharsetUTF8, ""
+
+	tests := []struct {
+		size     int
+		wantNums []string
+		wantAmts []string
+	}{
+		{0, []string{"5"}, []string{"16.50"}},
+		{5, []string{"5"}, []string{"16.50"}},
+		{2, []string{"2", "2", "1"}, []string{"3.30", "7.70", "5.50"}},
+		{4, []string{"4", "1"}, []string{"11.00", "5.50"}},
+	}
+	for _, tt := range tests {
+		split7221Size = tt.size
+		outputs, err := Convert7221(new7221TestCFX(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) != len(tt.wantNums) {
+			t.Fatalf("size=%d: %d个报文, want %d", tt.size, len(outputs), len(tt.wantNums))
+		}
+		details := 0
+		for i, output := range outputs {
+			cfx := parseOutputCFX(t, output.Body)
+			head := cfx.MSG.BatchHead7221
+			if head.AllNum != tt.wantNums[i] || head.AllAmt != tt.wantAmts[i] {
+				t.Errorf("size=%d 第%d个报文 AllNum/AllAmt = %s/%s, want %s/%s", tt.size, i, head.AllNum, head.AllAmt, tt.wantNums[i], tt.wantAmts[i])
+			}
+			if output.Detail7221Count != len(cfx.MSG.DrawbackBody7221.DrawbackInfo7221) {
+				t.Errorf("size=%d 第%d个报文 Detail7221Count = %d", tt.size, i, output.Detail7221Count)
+			}
+			details += output.Detail7221Count
+		}
+		if details != 5 {
+			t.Errorf("size=%d: 明细总数 = %d, want 5", tt.size, details)
+		}
+	}
+}
+
+func TestConvert7221MissingBody(t *testing.T) {
+	if _, err := Convert7221(&CFX{HEAD: HEAD{MsgNo: "7221"}}); err == nil {
+		t.Error("缺少DrawbackBody7221应报错")
+	}
+}
+
+// new6100TestCFX 构造6100报文，每个金额一条明细
+func new6100TestCFX(taxOrgCode string, amounts ...string) *CFX {
+	body := &TaxBody6100{}
+	for i, amt := range amounts {
+		body.TaxBill6100 = append(body.TaxBill6100, TaxBill6100{
+			TaxOrgCode:  taxOrgCode,
+			TaxAmt:      amt,
+			ExpTaxVouNo: fmt.Sprintf("V%d", i+1),
+		})
+	}
+	return &CFX{MSG: MSG{TaxHead6100: &TaxHead6100{TreCode: "0100", PayBkCode: "313"}, TaxBody6100: body}}
+}
+
+func TestConvert6100To7211NormalizesAmounts(t *testing.T) {
+	defer func(charset string) { outputCharset = charset }(outputCharset)
+	outputCharset = CharsetUTF8
+
+	outputs, err := Convert6100To7211(new6100TestCFX("A01", "12.5", " 3.40", "7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 {
+		t.Fatalf("%d个报文, want 1", len(outputs))
+	}
+	cfx := parseOutputCFX(t, outputs[0].Body)
+	if got := cfx.MSG.BatchHead7211.AllAmt; got != "22.90" {
+		t.Errorf("AllAmt = %s, want 22.90", got)
+	}
+	for i, want := range []string{"12.50", "3.40", "7.00"} {
+		info := cfx.MSG.TaxBody7211.TaxInfo7211[i]
+		if info.Payment7211.TraAmt != want {
+			t.Errorf("第%d笔 TraAmt = %q, want %s", i, info.Payment7211.TraAmt, want)
+		}
+		subject := info.TaxType7211.SubjectList7211[0]
+		for _, got := range []string{subject.TaxAmt, subject.ExpTaxAmt, subject.DiscountTaxAmt, subject.FactTaxAmt} {
+			if got != want {
+				t.Errorf("第%d笔税目金额 = %q, want %s", i, got, want)
+			}
+		}
+	}
+}
+
+func TestConvert6100To7211MissingBody(t *testing.T) {
+	cfx := &CFX{MSG: MSG{TaxHead6100: &TaxHead6100{TreCode: "0100"}}}
+	if _, err := Convert6100To7211(cfx); err == nil {
+		t.Error("缺少TaxBody6100应报错")
+	}
+}
+
+func TestParseGroupKeys7211(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   string
+	}{
+		{nil, "TaxOrgCode"},
+		{[]string{"TreCode"}, "TaxOrgCode,TreCode"},
+		{[]string{" BudgetLevelCode ", "TaxOrgCode", ""}, "TaxOrgCode,BudgetLevelCode"},
+	}
+	for _, tt := range tests {
+		keys, err := ParseGroupKeys7211(tt.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(keys, ","); got != tt.want {
+			t.Errorf("ParseGroupKeys7211(%v) = %s, want %s", tt.fields, got, tt.want)
+		}
+	}
+	if _, err := ParseGroupKeys7211([]string{"NoSuchField"}); err == nil {
+		t.Error("不存在的分组字段应报错")
+	}
+}
+
+func TestConvert6100To7211GroupingAndOrder(t *testing.T) {
+	defer func(charset string, size int, keys []string) {
+		outputCharset, split7211Size, groupKeys7211 = charset, size, keys
+	}(outputCharset, split7211Size, groupKeys7211)
+	outputCharset = CharsetUTF8
+	groupKeys7211 = []string{"TaxOrgCode", "BudgetLevelCode"}
+
+	cfx := &CFX{MSG: MSG{
+		TaxHead6100: &TaxHead6100{TreCode: "0100", PayBkCode: "313"},
+		TaxBody6100: &TaxBody6100{TaxBill6100: []TaxBill6100{
+			{TaxOrgCode: "B02", BudgetLevelCode: "1", TaxAmt: "1.00", ExpTaxVouNo: "V1"},
+			{TaxOrgCode: "A01", BudgetLevelCode: "2", TaxAmt: "2.00", ExpTaxVouNo: "V2"},
+			{TaxOrgCode: "A01", BudgetLevelCode: "1", TaxAmt: "3.00", ExpTaxVouNo: "V3"},
+			{TaxOrgCode: "B02", BudgetLevelCode: "1", TaxAmt: "4.00", ExpTaxVouNo: "V4"},
+			{TaxOrgCode: "A01", BudgetLevelCode: "2", TaxAmt: "5.00", ExpTaxVouNo: "V5"},
+		}},
+	}}
+
+	tests := []struct {
+		size     int
+		wantOrgs []string
+		wantAmts []string
+		wantVous []string
+	}{
+		{0, []string{"A01", "A01", "B02"}, []string{"3.00", "7.00", "5.00"}, []string{"V3", "V2,V5", "V1,V4"}},
+		{1, []string{"A01", "A01", "A01", "B02", "B02"}, []string{"3.00", "2.00", "5.00", "1.00", "4.00"}, []string{"V3", "V2", "V5", "V1", "V4"}},
+	}
+	for _, tt := range tests {
+		split7211Size = tt.size
+		outputs, err := Convert6100To7211(cfx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) != len(tt.wantOrgs) {
+			t.Fatalf("size=%d: %d个报文, want %d", tt.size, len(outputs), len(tt.wantOrgs))
+		}
+		for i, output := range outputs {
+			head := parseOutputCFX(t, output.Body).MSG.BatchHead7211
+			var vous []string
+			for _, ref := range output.SourceRefs {
+				vous = append(vous, ref.ExpTaxVouNo)
+			}
+			if head.TaxOrgCode != tt.wantOrgs[i] || head.AllAmt != tt.wantAmts[i] || strings.Join(vous, ",") != tt.wantVous[i] {
+				t.Errorf("size=%d 第%d个报文 TaxOrgCode/AllAmt/明细 = %s/%s/%v, want %s/%s/%s",
+					tt.size, i, head.TaxOrgCode, head.AllAmt, vous, tt.wantOrgs[i], tt.wantAmts[i], tt.wantVous[i])
+			}
+		}
+	}
+}
+
+func TestGenerateXMLStringPreservesValueSpaces(t *testing.T) {
+	defer func(charset string, pretty bool) { outputCharset, prettyXML = charset, pretty }(outputCharset, prettyXML)
+	outputCharset = CharsetUTF8
+
+	info := DrawbackInfo7221{TraNo: "1", PayeeName: "某某 有限  公司", TaxPayName: " 张三 ", PayeeAcct: "6222 0000"}
+	cfx := CFX{
+		HEAD: HEAD{MsgNo: "7221", MsgID: "ID 1"},
+		MSG: MSG{
+			BatchHead7221:    &BatchHead7221{AllNum: "1", AllAmt: "1.00"},
+			DrawbackBody7221: &DrawbackBody7221{DrawbackInfo7221: []DrawbackInfo7221{info}},
+		},
+	}
+
+	for _, pretty := range []bool{false, true} {
+		prettyXML = pretty
+		body, err := generateXMLString(cfx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pretty && strings.Contains(body, "\n") {
+			t.Errorf("紧凑输出不应包含换行: %s", body)
+		}
+		if pretty && !strings.Contains(body, "\n  <HEAD>") {
+			t.Errorf("缩进输出应换行缩进: %s", body)
+		}
+		got := parseOutputCFX(t, body)
+		if got.HEAD.MsgID != "ID 1" {
+			t.Errorf("pretty=%v MsgID = %q, want %q", pretty, got.HEAD.MsgID, "ID 1")
+		}
+		gotInfo := got.MSG.DrawbackBody7221.DrawbackInfo7221[0]
+		if gotInfo.PayeeName != info.PayeeName || gotInfo.TaxPayName != info.TaxPayName || gotInfo.PayeeAcct != info.PayeeAcct {
+			t.Errorf("pretty=%v 元素值中的空格未保留: %+v", pretty, gotInfo)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Converter 报文转换器：输入一个源报文，输出转换后的一个或多个报文
+type Converter interface {
+	Convert(cfx *CFX) ([]*OutputData, error)
+}
+
+// ConverterFunc 将普通函数适配为Converter
+type ConverterFunc func(cfx *CFX) ([]*OutputData, error)
+
+// Convert 实现Converter接口
+func (f ConverterFunc) Convert(cfx *CFX) ([]*OutputData, error) {
+	return f(cfx)
+}
+
+// UnsupportedMsgTypeError 没有注册转换器的报文类型
+type UnsupportedMsgTypeError struct {
+	MsgNo string
+}
+
+func (e *UnsupportedMsgTypeError) Error() string {
+	if e.MsgNo == "" {
+		return "无法识别报文类型"
+	}
+	return fmt.Sprintf("报文类型[%s]没有对应的转换器", e.MsgNo)
+}
+
+var (
+	convertersLock sync.RWMutex
+	converters     = map[string]Converter{}
+)
+
+func init() {
+	// 内置转换器
+	RegisterConverter("7221", ConverterFunc(Convert7221))
+	RegisterConverter("6100", ConverterFunc(Convert6100To7211))
+	RegisterConverter("7211", ConverterFunc(Convert7211))
+}
+
+// RegisterConverter 按报文编号注册转换器，重复注册会panic
+func RegisterConverter(msgNo string, converter Converter) {
+	convertersLock.Lock()
+	defer convertersLock.Unlock()
+
+	if converter == nil {
+		panic("RegisterConverter: converter is nil")
+	}
+	if _, dup := converters[msgNo]; dup {
+		panic("RegisterConverter: called twice for msgNo " + msgNo)
+	}
+	converters[msgNo] = converter
+}
+
+// LookupConverter 按报文编号查找转换器
+func LookupConverter(msgNo string) (Converter, bool) {
+	convertersLock.RLock()
+	defer convertersLock.RUnlock()
+
+	converter, ok := converters[msgNo]
+	return converter, ok
+}
+
+// RegisteredMsgTypes 返回已注册转换器的报文编号（已排序）
+func RegisteredMsgTypes() []string {
+	convertersLock.RLock()
+	defer convertersLock.RUnlock()
+
+	msgTypes := make([]string, 0, len(converters))
+	for msgNo := range converters {
+		msgTypes = append(msgTypes, msgNo)
+	}
+	sort.Strings(msgTypes)
+	return msgTypes
+}
+
+// RawXMLElement 结构体中未建模的XML元素，原样保留
+type RawXMLElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+// Element 按元素名查找MSG中未建模的元素，找不到时返回nil
+func (m *MSG) Element(name string) *RawXMLElement {
+	for i := range m.Others {
+		if m.Others[i].XMLName.Local == name {
+			return &m.Others[i]
+		}
+	}
+	return nil
+}
+
+// DecodeElement 将MSG中未建模的元素解析到v，供新增报文类型的转换器使用
+func (m *MSG) DecodeElement(name string, v any) error {
+	element := m.Element(name)
+	if element == nil {
+		return fmt.Errorf("MSG中不存在元素 %s", name)
+	}
+	content, err := xml.Marshal(element)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(content, v)
+}
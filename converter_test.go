@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConvertMsgUnsupportedMsgType(t *testing.T) {
+	tests := []struct {
+		content string
+		wantMsg string
+	}{
+		{`<?xml version="1.0" encoding="UTF-8"?><CFX><HEAD><MsgNo>9999</MsgNo></HEAD><MSG></MSG></CFX>`, "报文类型[9999]没有对应的转换器"},
+		{`<?xml version="1.0" encoding="UTF-8"?><CFX><HEAD></HEAD><MSG></MSG></CFX>`, "无法识别报文类型"},
+	}
+	for _, tt := range tests {
+		outputs, err := ConvertMsg(writeTestFile(t, "in.xml", tt.content), &Setting{})
+		var unsupported *UnsupportedMsgTypeError
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("err = %v, want UnsupportedMsgTypeError", err)
+		}
+		if err.Error() != tt.wantMsg || outputs != nil {
+			t.Errorf("err = %q, want %q", err, tt.wantMsg)
+		}
+	}
+}
+
+func TestRegisterConverter(t *testing.T) {
+	type testBody struct {
+		Name string `xml:"Name"`
+	}
+	var got testBody
+	RegisterConverter("9901", ConverterFunc(func(cfx *CFX) ([]*OutputData, error) {
+		return nil, cfx.MSG.DecodeElement("TestBody9901", &got)
+	}))
+	converter, ok := LookupConverter("9901")
+	if !ok {
+		t.Fatal("未找到注册的转换器")
+	}
+
+	var cfx CFX
+	if err := unmarshalXMLString(`<CFX><HEAD><MsgNo>9901</MsgNo></HEAD><MSG><TestBody9901><Name>张三</Name></TestBody9901></MSG></CFX>`, &cfx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := converter.Convert(&cfx); err != nil || got.Name != "张三" {
+		t.Errorf("Convert = %v, Name = %q", err, got.Name)
+	}
+	if err := cfx.MSG.DecodeElement("Missing", &got); err == nil {
+		t.Error("不存在的元素应报错")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("重复注册应panic")
+		}
+	}()
+	RegisterConverter("7221", ConverterFunc(Convert7221))
+}
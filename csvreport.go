@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+)
+
+// writeExcelCSV 写入带UTF-8 BOM的CSV报告，方便直接用Excel打开，目录不存在时自动创建
+func writeExcelCSV(path string, header []string, rows [][]string) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	if _, err := file.Write(utf8BOM); err != nil {
+		return err
+	}
+	return csv.NewWriter(file).WriteAll(append([][]string{header}, rows...))
+}
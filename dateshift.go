@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DateLayout 报文中日期字段的格式
+const DateLayout = "20060102"
+
+// BusinessCalendar 节假日日历
+// 日历文件每行一个日期: "20261001" 或 "20261001 holiday" 表示节假日，"20261010 workday" 表示调休上班的周末，#开头为注释
+type BusinessCalendar struct {
+	holidays map[string]bool
+	workdays map[string]bool
+}
+
+// LoadBusinessCalendar 加载节假日日历文件，path为空时只按周末判断
+func LoadBusinessCalendar(path string) (*BusinessCalendar, error) {
+	calendar := &BusinessCalendar{holidays: map[string]bool{}, workdays: map[string]bool{}}
+	if path == "" {
+		return calendar, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取节假日日历失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if _, err := time.Parse(DateLayout, fields[0]); err != nil {
+			return nil, fmt.Errorf("节假日日历第%d行日期格式错误: %s", lineNo, fields[0])
+		}
+		kind := "holiday"
+		if len(fields) > 1 {
+			kind = strings.ToLower(fields[1])
+		}
+		switch kind {
+		case "holiday":
+			calendar.holidays[fields[0]] = true
+		case "workday":
+			calendar.workdays[fields[0]] = true
+		default:
+			return nil, fmt.Errorf("节假日日历第%d行类型错误: %s", lineNo, fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取节假日日历失败: %v", err)
+	}
+	return calendar, nil
+}
+
+// IsWorkday 判断是否为工作日：调休上班日为工作日，节假日和周末为非工作日
+func (c *BusinessCalendar) IsWorkday(t time.Time) bool {
+	date := t.Format(DateLayout)
+	if c.workdays[date] {
+		return true
+	}
+	if c.holidays[date] {
+		return false
+	}
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
+
+// NextWorkday 返回不早于t的第一个工作日
+func (c *BusinessCalendar) NextWorkday(t time.Time) time.Time {
+	// 最多顺延一年，避免日历配置错误时死循环
+	for i := 0; i < 366 && !c.IsWorkday(t); i++ {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// DateShifter 业务日期平移
+// 以源报文的WorkDate（6100无WorkDate时取ExportDate）为基准，所有日期字段平移到目标业务日期，保持相对间隔不变
+// 开启顺延时只有WorkDate、EntrustDate等业务日期顺延到工作日，税款所属期、开票日期等只按天数平移
+type DateShifter struct {
+	target         time.Time
+	calendar       *BusinessCalendar
+	skipNonWorkday bool
+
+	days int // 当前源报文的平移天数
+}
+
+// dateShifter 当前运行的日期平移器，为nil时不平移
+var dateShifter *DateShifter
+
+// ConfigureDateShift 按配置设置业务日期平移，每次转换运行开始时调用一次
+func ConfigureDateShift(setting *Setting) error {
+	if setting.TargetBusinessDate == "" {
+		dateShifter = nil
+		return nil
+	}
+
+	target, err := time.ParseInLocation(DateLayout, setting.TargetBusinessDate, time.Local)
+	if err != nil {
+		return fmt.Errorf("目标业务日期[%s]格式应为%s: %v", setting.TargetBusinessDate, DateLayout, err)
+	}
+	calendar, err := LoadBusinessCalendar(setting.HolidayCalendarFile)
+	if err != nil {
+		return err
+	}
+	dateShifter = &DateShifter{target: target, calendar: calendar, skipNonWorkday: setting.SkipNonWorkdays}
+	if business := dateShifter.roll(target); !business.Equal(target) {
+		AppLogger.Printf("目标业务日期%s不是工作日，业务日期顺延为%s", target.Format(DateLayout), business.Format(DateLayout))
+	}
+	AppLogger.Printf("业务日期平移: 目标业务日期 %s", target.Format(DateLayout))
+	return nil
+}
+
+// Begin 根据源报文的基准日期计算平移天数，每个源报文转换前调用
+func (s *DateShifter) Begin(source *CFX) {
+	if s == nil {
+		return
+	}
+	s.days = 0
+	base, ok := sourceBaseDate(source)
+	if !ok {
+		AppLogger.Printf("源报文MsgID[%s]没有有效的WorkDate/ExportDate，日期字段不平移", source.HEAD.MsgID)
+		return
+	}
+	s.days = daysBetween(base, s.target)
+}
+
+// daysBetween 两个日期相差的天数，按日历日期计算，不受时区和夏令时影响
+func daysBetween(from, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+// Shift 将日期按天数平移，不是有效日期时原样返回；s为nil时不平移
+func (s *DateShifter) Shift(date string) string {
+	if s == nil {
+		return date
+	}
+	t, err := time.ParseInLocation(DateLayout, date, time.Local)
+	if err != nil {
+		return date
+	}
+	return t.AddDate(0, 0, s.days).Format(DateLayout)
+}
+
+// ShiftBusinessDate 平移业务日期，开启顺延时遇周末、节假日顺延到下一个工作日
+func (s *DateShifter) ShiftBusinessDate(date string) string {
+	if s == nil {
+		return date
+	}
+	t, err := time.ParseInLocation(DateLayout, date, time.Local)
+	if err != nil {
+		return date
+	}
+	return s.roll(t.AddDate(0, 0, s.days)).Format(DateLayout)
+}
+
+// roll 开启顺延时返回不早于t的第一个工作日，否则原样返回
+func (s *DateShifter) roll(t time.Time) time.Time {
+	if !s.skipNonWorkday {
+		return t
+	}
+	return s.calendar.NextWorkday(t)
+}
+
+// sourceBaseDate 源报文的基准日期
+func sourceBaseDate(source *CFX) (time.Time, bool) {
+	candidates := []string{source.HEAD.WorkDate}
+	if source.MSG.TaxHead6100 != nil {
+		candidates = append(candidates, source.MSG.TaxHead6100.ExportDate)
+	}
+	for _, date := range candidates {
+		if t, err := time.ParseInLocation(DateLayout, date, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// BusinessDate 当前业务日期：配置了目标业务日期时为目标业务日期（开启顺延时顺延到工作日），否则为业务时钟的当天
+func BusinessDate() string {
+	if dateShifter != nil {
+		return dateShifter.roll(dateShifter.target).Format(DateLayout)
+	}
+	return BusinessNow().Format(DateLayout)
+}
+
+// PeriodDate 税款所属期等非业务日期：配置了目标业务日期时为目标业务日期，不顺延，否则为业务时钟的当天
+func PeriodDate() string {
+	if dateShifter != nil {
+		return dateShifter.target.Format(DateLayout)
+	}
+	return BusinessNow().Format(DateLayout)
+}
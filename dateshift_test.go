@@ -0,0 +1,165 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseDate(t *testing.T, date string) time.Time {
+	t.Helper()
+	d, err := time.ParseInLocation(DateLayout, date, time.Local)
+	if err != nil {
+		t.Fatalf("日期%s格式错误: %v", date, err)
+	}
+	return d
+}
+
+func TestDateShifterShift(t *testing.T) {
+	calendar := &BusinessCalendar{
+		holidays: map[string]bool{"20261020": true},
+		workdays: map[string]bool{"20261024": true},
+	}
+	tests := []struct {
+		name     string
+		target   string
+		workDate string
+		skip     bool
+		date     string
+		want     string
+	}{
+		{"向后平移", "20261020", "20261015", false, "20261010", "20261015"},
+		{"向前平移一天", "20261014", "20261015", false, "20261010", "20261009"},
+		{"向前平移两天", "20261013", "20261015", false, "20261010", "20261008"},
+		{"向前平移十天", "20261005", "20261015", false, "20261012", "20261002"},
+		{"不平移", "20261015", "20261015", false, "20261012", "20261012"},
+		{"跨月跨年", "20270105", "20261230", false, "20261228", "20270103"},
+		{"平移到周末顺延", "20261019", "20261015", true, "20261013", "20261019"},
+		{"平移到节假日顺延", "20261021", "20261015", true, "20261014", "20261021"},
+		{"调休上班日不顺延", "20261026", "20261016", true, "20261014", "20261024"},
+		{"不顺延时保留周末", "20261019", "20261015", false, "20261013", "20261017"},
+		{"无效日期原样返回", "20261020", "20261015", false, "2026-10-10", "2026-10-10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &DateShifter{target: mustParseDate(t, tt.target), calendar: calendar, skipNonWorkday: tt.skip}
+			s.Begin(&CFX{HEAD: HEAD{WorkDate: tt.workDate}})
+			if got := s.ShiftBusinessDate(tt.date); got != tt.want {
+				t.Errorf("ShiftBusinessDate(%s) = %s, want %s", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateShifterShiftDoesNotRoll(t *testing.T) {
+	calendar := &BusinessCalendar{holidays: map[string]bool{"20261020": true}}
+	s := &DateShifter{target: mustParseDate(t, "20261017"), calendar: calendar, skipNonWorkday: true}
+	s.Begin(&CFX{HEAD: HEAD{WorkDate: "20261015"}})
+
+	// 业务日期顺延到工作日，税款所属期等日期只按天数平移
+	tests := []struct {
+		date, wantShift, wantBusiness string
+	}{
+		{"20261015", "20261017", "20261019"},
+		{"20261018", "20261020", "20261021"},
+		{"20261001", "20261003", "20261005"},
+	}
+	for _, tt := range tests {
+		if got := s.Shift(tt.date); got != tt.wantShift {
+			t.Errorf("Shift(%s) = %s, want %s", tt.date, got, tt.wantShift)
+		}
+		if got := s.ShiftBusinessDate(tt.date); got != tt.wantBusiness {
+			t.Errorf("ShiftBusinessDate(%s) = %s, want %s", tt.date, got, tt.wantBusiness)
+		}
+	}
+}
+
+func TestConvertShiftsOnlyBusinessDatesToWorkday(t *testing.T) {
+	defer func() { dateShifter = nil }()
+	defer func(charset string) { outputCharset = charset }(outputCharset)
+	outputCharset = CharsetUTF8
+
+	// 目标业务日期20261017为周六：WorkDate/EntrustDate顺延到20261019，税款所属期为20261017
+	if err := ConfigureDateShift(&Setting{TargetBusinessDate: "20261017", SkipNonWorkdays: true}); err != nil {
+		t.Fatal(err)
+	}
+	source := new6100TestCFX("A01", "1.00")
+	source.MSG.TaxHead6100.ExportDate = "20261015"
+	dateShifter.Begin(source)
+	outputs, err := Convert6100To7211(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfx := parseOutputCFX(t, outputs[0].Body)
+	if cfx.HEAD.WorkDate != "20261019" || cfx.MSG.BatchHead7211.EntrustDate != "20261019" {
+		t.Errorf("WorkDate/EntrustDate = %s/%s, want 20261019", cfx.HEAD.WorkDate, cfx.MSG.BatchHead7211.EntrustDate)
+	}
+	taxType := cfx.MSG.TaxBody7211.TaxInfo7211[0].TaxType7211
+	if taxType.TaxStartDate != "20261017" || taxType.TaxEndDate != "20261017" {
+		t.Errorf("TaxStartDate/TaxEndDate = %s/%s, want 20261017", taxType.TaxStartDate, taxType.TaxEndDate)
+	}
+
+	source7221 := new7221TestCFX(1)
+	source7221.HEAD.WorkDate = "20261015"
+	source7221.MSG.BatchHead7221.EntrustDate = "20261015"
+	source7221.MSG.DrawbackBody7221.DrawbackInfo7221[0].BillDate = "20261015"
+	dateShifter.Begin(source7221)
+	outputs, err = Convert7221(source7221)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfx = parseOutputCFX(t, outputs[0].Body)
+	if got := cfx.MSG.BatchHead7221.EntrustDate; got != "20261019" {
+		t.Errorf("7221 EntrustDate = %s, want 20261019", got)
+	}
+	if got := cfx.MSG.DrawbackBody7221.DrawbackInfo7221[0].BillDate; got != "20261017" {
+		t.Errorf("7221 BillDate = %s, want 20261017", got)
+	}
+}
+
+func TestDateShifterBaseDate(t *testing.T) {
+	s := &DateShifter{target: mustParseDate(t, "20261020"), calendar: &BusinessCalendar{}}
+
+	// 6100没有WorkDate时以ExportDate为基准
+	s.Begin(&CFX{MSG: MSG{TaxHead6100: &TaxHead6100{ExportDate: "20261018"}}})
+	if got := s.Shift("20261018"); got != "20261020" {
+		t.Errorf("以ExportDate为基准: got %s, want 20261020", got)
+	}
+
+	// 没有有效基准日期时不平移
+	s.Begin(&CFX{HEAD: HEAD{WorkDate: "bad"}})
+	if got := s.Shift("20261018"); got != "20261018" {
+		t.Errorf("无基准日期: got %s, want 20261018", got)
+	}
+
+	var nilShifter *DateShifter
+	nilShifter.Begin(&CFX{})
+	if got := nilShifter.Shift("20261018"); got != "20261018" {
+		t.Errorf("nil平移器: got %s, want 20261018", got)
+	}
+}
+
+func TestConfigureDateShiftRollForward(t *testing.T) {
+	defer func() { dateShifter = nil }()
+
+	tests := []struct {
+		target string
+		skip   bool
+		want   string
+	}{
+		{"20261017", true, "20261019"},
+		{"20261017", false, "20261017"},
+		{"20261019", true, "20261019"},
+	}
+	for _, tt := range tests {
+		if err := ConfigureDateShift(&Setting{TargetBusinessDate: tt.target, SkipNonWorkdays: tt.skip}); err != nil {
+			t.Fatalf("ConfigureDateShift(%s): %v", tt.target, err)
+		}
+		if got := BusinessDate(); got != tt.want {
+			t.Errorf("目标%s skip=%v: BusinessDate() = %s, want %s", tt.target, tt.skip, got, tt.want)
+		}
+	}
+
+	if err := ConfigureDateShift(&Setting{TargetBusinessDate: "2026-10-17"}); err == nil {
+		t.Errorf("目标日期格式错误时应返回错误")
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"crypto/des"
 	"encoding/hex"
 	"fmt"
-	"golang.org/x/text/encoding/simplifiedchinese"
 	_ "golang.org/x/text/transform"
 	"io/ioutil"
 	"strings"
@@ -51,11 +50,10 @@ func DecryptFile(encryptedFilePath, encKey string) (string, error) {
 		return "", fmt.Errorf("解密失败: %v", err)
 	}
 
-	// 转换为GBK编码的字符串
-	gbkDecoder := simplifiedchinese.GBK.NewDecoder()
-	decryptedStr, err := gbkDecoder.String(string(decrypted))
+	// 按XML声明（或自动检测）的字符集解码为UTF-8字符串
+	decryptedStr, _, err := DecodeXMLBytes(decrypted)
 	if err != nil {
-		return "", fmt.Errorf("GBK解码失败: %v", err)
+		return "", err
 	}
 
 	return strings.TrimSpace(decryptedStr), nil
@@ -101,16 +99,16 @@ func pkcs5Unpad(data []byte) ([]byte, error) {
 }
 
 // SaveFile 保存解密后的文件（对应C#中的SaveFile方法）
+// 按XML声明中的字符集编码写入，没有声明时使用GBK
 func SaveFile(text, fileName string) error {
-	// 将文本转换为GBK编码
-	gbkEncoder := simplifiedchinese.GBK.NewEncoder()
-	gbkText, err := gbkEncoder.String(text)
+	charset := charsetOrDefault(declaredCharset([]byte(text)), DefaultCharset)
+	encodedText, err := EncodeXMLString(text, charset)
 	if err != nil {
-		return fmt.Errorf("GBK编码失败: %v", err)
+		return err
 	}
 
 	// 写入文件
-	err = ioutil.WriteFile(fileName, []byte(gbkText), 0644)
+	err = ioutil.WriteFile(fileName, []byte(encodedText), 0644)
 	if err != nil {
 		return fmt.Errorf("写入文件失败: %v", err)
 	}
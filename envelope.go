@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// EnvelopeFileName 报文信封导出文件名，每行一个JSON记录
+const EnvelopeFileName = "envelopes.jsonl"
+
+// MQ信封的默认配置，与原样例报文保持一致
+const (
+	DefaultMQQueueManager = "QM_TIPS_INT_34"
+	DefaultMQSourceQueue  = "TIPS.GK200.INT.NORMAL.IN.TRANSLOG"
+	DefaultMQDestination  = "GK200000002000"
+)
+
+// MQEnvelopeConfig 按环境配置的MQ信封参数
+type MQEnvelopeConfig struct {
+	QueueManager string // 队列管理器，用于ReplyToQMgr和生成MQ MSGID
+	SourceQueue  string // 源队列
+	Destination  string // RFH2中的DESTINATION
+}
+
+// NewMQEnvelopeConfig 根据配置生成MQ信封参数，未配置的项使用默认值
+func NewMQEnvelopeConfig(setting *Setting) MQEnvelopeConfig {
+	return MQEnvelopeConfig{
+		QueueManager: valueOrDefault(setting.MQQueueManager, environment.QueueManager),
+		SourceQueue:  valueOrDefault(setting.MQSourceQueue, environment.SourceQueue),
+		Destination:  valueOrDefault(setting.MQDestination, environment.Destination),
+	}
+}
+
+// valueOrDefault 去掉首尾空格后为空时返回默认值
+func valueOrDefault(value, defaultValue string) string {
+	if value = strings.TrimSpace(value); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// TipsHeadInfo TIPS报文头信息
+type TipsHeadInfo struct {
+	SRC      string `json:"SRC"`
+	DES      string `json:"DES"`
+	MsgNo    string `json:"MsgNo"`
+	MsgID    string `json:"MsgID"`
+	MsgRef   string `json:"MsgRef"`
+	OriMsgNo string `json:"OriMsgNo"`
+}
+
+// MQMDInfo MQ消息描述符
+type MQMDInfo struct {
+	SourceQueue      string `json:"SourceQueue"`
+	Persistence      string `json:"Persistence"`
+	CORRELID         string `json:"CORRELID"`
+	MSGID            string `json:"MSGID"`
+	UserIdentifier   string `json:"UserIdentifier"`
+	Priority         string `json:"Priority"`
+	Encoding         string `json:"Encoding"`
+	CodedCharSetId   string `json:"CodedCharSetId"`
+	Expiry           string `json:"Expiry"`
+	PutDate          string `json:"PutDate"`
+	PutTime          string `json:"PutTime"`
+	ReplyToQMgr      string `json:"ReplyToQMgr"`
+	ReplyToQ         string `json:"ReplyToQ"`
+	Report           string `json:"Report"`
+	Format           string `json:"Format"`
+	ApplIdentityData string `json:"ApplIdentityData"`
+}
+
+// RFH2Info MQ RFH2头及usr属性
+type RFH2Info struct {
+	Encoding       string `json:"Encoding"`
+	CodedCharSetId string `json:"CodedCharSetId"`
+	Dlv            string `json:"Dlv"`
+	Pri            string `json:"Pri"`
+	ISCURRCENTER   string `json:"ISCURRCENTER"`
+	MSGFORMAT      string `json:"MSGFORMAT"`
+	MSGFLAG        string `json:"MSGFLAG"`
+	MSGORIFLAG     string `json:"MSGORIFLAG"`
+	Flags          string `json:"Flags"`
+	Format         string `json:"Format"`
+	NameValueCCSID string `json:"NameValueCCSID"`
+	Version        string `json:"Version"`
+	APP            string `json:"APP"`
+	CorrelationID  string `json:"CorrelationID"`
+	DES            string `json:"DES"`
+	DESTINATION    string `json:"DESTINATION"`
+	EXCEPTIONMSG   string `json:"EXCEPTIONMSG"`
+	EXCEPTIONTYPE  string `json:"EXCEPTIONTYPE"`
+	MSGDESC        string `json:"MSGDESC"`
+	MSGTYPE        string `json:"MSGTYPE"`
+	MsgID          string `json:"MsgID"`
+	MsgRef         string `json:"MsgRef"`
+	ServiceId      string `json:"ServiceId"`
+	ServiceId9120  string `json:"ServiceId9120"`
+	TIPSTAGFLAG    string `json:"TIPSTAGFLAG"`
+	TIPS_MSGNO     string `json:"TIPS_MSGNO"`
+	TIPS_ORIMSGNO  string `json:"TIPS_ORIMSGNO"`
+	MsgFormat      string `json:"msgFormat"`
+	MsgReserve     string `json:"msgReserve"`
+	MsgSrcAddr     string `json:"msgSrcAddr"`
+	MsgTarAddr     string `json:"msgTarAddr"`
+	MsgType        string `json:"msgType"`
+	MsgVer         string `json:"msgVer"`
+}
+
+// EnvelopeRecord 导出的报文信封记录：MQ头信息 + 报文体
+// Body 为按 BodyCharset 编码后的报文原始字节的Base64，回放时解码后直接作为消息体发送
+type EnvelopeRecord struct {
+	File        string        `json:"file"`
+	MsgNo       string        `json:"msgNo"`
+	TipsHead    *TipsHeadInfo `json:"tipsHead"`
+	MQMD        *MQMDInfo     `json:"mqmd"`
+	RFH2        *RFH2Info     `json:"rfh2"`
+	BodyCharset string        `json:"bodyCharset"`
+	Body        string        `json:"body"`
+}
+
+// BuildEnvelope 根据输出报文的报文头生成TIPS报文头、MQMD和RFH2信息
+// 在报文最终生成（包括按模板重新生成）之后调用，保证信封与报文内容一致
+func BuildEnvelope(data *OutputData, config MQEnvelopeConfig) {
+	if data.Cfx == nil {
+		return
+	}
+	head := data.Cfx.HEAD
+	ccsid := CharsetCCSID(bodyCharset(data.Body))
+	data.MsgNo = head.MsgNo
+	data.TipsHead = BuildTipsHead(head)
+	data.MQMD = BuildMQMD(config, ccsid)
+	data.RFH2 = BuildRFH2(head, config, ccsid)
+}
+
+// BuildTipsHead 构建TIPS报文头信息
+func BuildTipsHead(head HEAD) *TipsHeadInfo {
+	return &TipsHeadInfo{
+		SRC:      head.SRC,
+		DES:      head.DES,
+		MsgNo:    head.MsgNo,
+		MsgID:    head.MsgID,
+		MsgRef:   head.MsgRef,
+		OriMsgNo: "",
+	}
+}
+
+// bodyCharset 报文体的字符集，取XML声明中的encoding
+func bodyCharset(body string) string {
+	return charsetOrDefault(declaredCharset([]byte(body)), DefaultCharset)
+}
+
+// BuildMQMD 构建MQ消息描述符，放入时间取业务时钟，MSGID按队列管理器重新生成，ccsid为报文体字符集对应的CCSID
+func BuildMQMD(config MQEnvelopeConfig, ccsid string) *MQMDInfo {
+	now := BusinessNow()
+	return &MQMDInfo{
+		SourceQueue:      config.SourceQueue,
+		Persistence:      "1",
+		CORRELID:         "000000000000000000000000000000000000000000000000",
+		MSGID:            GenerateMQMsgId(config.QueueManager),
+		UserIdentifier:   "mqm",
+		Priority:         "4",
+		Encoding:         "273",
+		CodedCharSetId:   ccsid,
+		Expiry:           "-1",
+		PutDate:          now.Format("2006.01.02"),
+		PutTime:          now.Format("15:04:05.000"),
+		ReplyToQMgr:      config.QueueManager,
+		ReplyToQ:         "",
+		Report:           "0",
+		Format:           "MQHRF2",
+		ApplIdentityData: "",
+	}
+}
+
+// BuildRFH2 构建RFH2头信息，ccsid为报文体字符集对应的CCSID
+func BuildRFH2(head HEAD, config MQEnvelopeConfig, ccsid string) *RFH2Info {
+	return &RFH2Info{
+		Encoding:       "273",
+		CodedCharSetId: ccsid,
+		Dlv:            "UNKNOWN",
+		Pri:            "UNKNOWN",
+		ISCURRCENTER:   "UNKNOWN",
+		MSGFORMAT:      "TIPS",
+		MSGFLAG:        "NORMAL",
+		MSGORIFLAG:     "UNKNOWN",
+		Flags:          "0",
+		Format:         "",
+		NameValueCCSID: "1208",
+		Version:        "2",
+		APP:            valueOrDefault(head.APP, environment.APP),
+		CorrelationID:  "524551000000000000000000000000000000000000000000",
+		DES:            head.DES,
+		DESTINATION:    config.Destination,
+		EXCEPTIONMSG:   "UNKNOWN",
+		EXCEPTIONTYPE:  "UNKNOWN",
+		MSGDESC:        "TIPS",
+		MSGTYPE:        "MSG",
+		MsgID:          head.MsgID,
+		MsgRef:         head.MsgRef,
+		ServiceId:      "UNKNOWN",
+		ServiceId9120:  "UNKNOWN",
+		TIPSTAGFLAG:    "UNKNOWN",
+		TIPS_MSGNO:     "UNKNOWN",
+		TIPS_ORIMSGNO:  "UNKNOWN",
+		MsgFormat:      "TIPS",
+		MsgReserve:     "",
+		MsgSrcAddr:     head.SRC,
+		MsgTarAddr:     head.DES,
+		MsgType:        head.MsgNo,
+		MsgVer:         valueOrDefault(head.VER, environment.VER),
+	}
+}
+
+// GenerateMQMsgId 生成24字节的MQ MSGID（48位十六进制）
+// 与MQ的格式一致: "AMQ " + 队列管理器名（12字节，不足补空格）+ 8字节唯一序号
+func GenerateMQMsgId(queueManager string) string {
+	qmgr := []byte(fmt.Sprintf("%-12.12s", queueManager))
+	seq, _ := strconv.ParseUint(GenerateUniqueId(), 10, 64)
+
+	id := make([]byte, 0, 24)
+	id = append(id, "AMQ "...)
+	id = append(id, qmgr...)
+	for i := 7; i >= 0; i-- {
+		id = append(id, byte(seq>>(uint(i)*8)))
+	}
+	return strings.ToUpper(hex.EncodeToString(id))
+}
+
+// NewEnvelopeRecord 根据输出报文生成信封记录
+func NewEnvelopeRecord(fileName string, data *OutputData) EnvelopeRecord {
+	return EnvelopeRecord{
+		File:        fileName,
+		MsgNo:       data.MsgNo,
+		TipsHead:    data.TipsHead,
+		MQMD:        data.MQMD,
+		RFH2:        data.RFH2,
+		BodyCharset: bodyCharset(data.Body),
+		Body:        base64.StdEncoding.EncodeToString([]byte(data.Body)),
+	}
+}
+
+// WriteEnvelopes 将信封记录写入目录下的 envelopes.jsonl
+func WriteEnvelopes(dir string, records []EnvelopeRecord) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, EnvelopeFileName)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建信封导出文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("写入信封导出文件失败: %v", err)
+	}
+	return nil
+}
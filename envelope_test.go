@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCharsetCCSID(t *testing.T) {
+	tests := map[string]string{
+		"GBK":     "1386",
+		"gb2312":  "1386",
+		"GB18030": "54936",
+		"utf-8":   "1208",
+		"":        "1386",
+	}
+	for charset, want := range tests {
+		if got := CharsetCCSID(charset); got != want {
+			t.Errorf("CharsetCCSID(%q) = %s, want %s", charset, got, want)
+		}
+	}
+}
+
+func TestBuildEnvelopeFollowsOutputCharset(t *testing.T) {
+	defer func(size int, charset, bkCode string) {
+		split7221Size, outputCharset, payeeOpBkCode = size, charset, bkCode
+	}(split7221Size, outputCharset, payeeOpBkCode)
+	split7221Size, payeeOpBkCode = 0, ""
+	config := NewMQEnvelopeConfig(&Setting{})
+
+	for _, charset := range []string{CharsetGBK, CharsetGB18030, CharsetUTF8} {
+		outputCharset = charset
+		outputs, err := Convert7221(new7221TestCFX(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := outputs[0]
+		BuildEnvelope(data, config)
+		want := CharsetCCSID(charset)
+		if data.MQMD.CodedCharSetId != want || data.RFH2.CodedCharSetId != want {
+			t.Errorf("%s: MQMD/RFH2 CodedCharSetId = %s/%s, want %s", charset, data.MQMD.CodedCharSetId, data.RFH2.CodedCharSetId, want)
+		}
+
+		record := NewEnvelopeRecord("a.xml", data)
+		if record.BodyCharset != charset {
+			t.Errorf("%s: BodyCharset = %s", charset, record.BodyCharset)
+		}
+		body, err := base64.StdEncoding.DecodeString(record.Body)
+		if err != nil || string(body) != data.Body {
+			t.Errorf("%s: 信封中的报文体与输出报文不一致", charset)
+		}
+	}
+}
+
+func TestBuildEnvelopeFromHead(t *testing.T) {
+	config := NewMQEnvelopeConfig(&Setting{MQQueueManager: "QM_TEST", MQDestination: " "})
+	if config.SourceQueue != DefaultMQSourceQueue || config.Destination != DefaultMQDestination {
+		t.Errorf("未配置的项应使用默认值: %+v", config)
+	}
+	data := &OutputData{
+		Body: `<?xml version="1.0" encoding="UTF-8"?><CFX/>`,
+		Cfx: &CFX{HEAD: HEAD{
+			SRC: "200000000000", DES: "300000000000", APP: "TIPS",
+			MsgNo: "7221", MsgID: "M1", MsgRef: "R1",
+		}},
+	}
+	BuildEnvelope(data, config)
+
+	if data.MsgNo != "7221" {
+		t.Errorf("MsgNo = %s", data.MsgNo)
+	}
+	head := data.TipsHead
+	if head.SRC != "200000000000" || head.DES != "300000000000" || head.MsgID != "M1" || head.MsgRef != "R1" {
+		t.Errorf("TIPS报文头 = %+v", head)
+	}
+	if data.MQMD.ReplyToQMgr != "QM_TEST" || data.MQMD.SourceQueue != DefaultMQSourceQueue {
+		t.Errorf("MQMD = %+v", data.MQMD)
+	}
+	// "AMQ " + 补齐到12字节的队列管理器名
+	if prefix := "414D5120514D5F5445535420202020"; !strings.HasPrefix(data.MQMD.MSGID, prefix) || len(data.MQMD.MSGID) != 48 {
+		t.Errorf("MQ MSGID = %s", data.MQMD.MSGID)
+	}
+	rfh2 := data.RFH2
+	if rfh2.MsgID != "M1" || rfh2.MsgRef != "R1" || rfh2.DES != "300000000000" ||
+		rfh2.DESTINATION != DefaultMQDestination || rfh2.MsgType != "7221" {
+		t.Errorf("RFH2 = %+v", rfh2)
+	}
+}
+
+func TestWriteEnvelopes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "report")
+	records := []EnvelopeRecord{
+		{File: "a.xml", MsgNo: "7221", MQMD: &MQMDInfo{CodedCharSetId: "1208"}, BodyCharset: CharsetUTF8},
+		{File: "b.xml", MsgNo: "7211", MQMD: &MQMDInfo{CodedCharSetId: "1386"}, BodyCharset: CharsetGBK},
+	}
+	if err := WriteEnvelopes(dir, records); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(dir, EnvelopeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var got []EnvelopeRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record EnvelopeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record)
+	}
+	if len(got) != 2 || got[1].File != "b.xml" || got[1].MQMD.CodedCharSetId != "1386" {
+		t.Errorf("信封记录 = %+v", got)
+	}
+}
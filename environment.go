@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultEnvironmentName 未配置环境时使用的内置环境
+const DefaultEnvironmentName = "default"
+
+// EnvironmentProfile TIPS测试节点的环境配置
+// 报文头的SRC/DES/APP/VER和MQ信封地址按环境统一设置，为空的项使用内置环境的值
+type EnvironmentProfile struct {
+	Name         string `json:"-"`
+	SRC          string `json:"src"`           // 发起节点代码
+	DES          string `json:"des"`           // 接收节点代码
+	APP          string `json:"app"`           // 应用名称
+	VER          string `json:"ver"`           // 报文版本号
+	QueueManager string `json:"queue_manager"` // 队列管理器，用于MQMD的ReplyToQMgr和MSGID
+	SourceQueue  string `json:"source_queue"`  // 源队列
+	Destination  string `json:"destination"`   // RFH2的DESTINATION
+
+	selected bool // 是否在配置中明确选择，只有明确选择的环境才改写报文头
+}
+
+// defaultEnvironment 内置环境
+var defaultEnvironment = EnvironmentProfile{
+	Name:         DefaultEnvironmentName,
+	SRC:          "100000000000",
+	DES:          "333333333333",
+	APP:          "TIPS",
+	VER:          "1.0",
+	QueueManager: DefaultMQQueueManager,
+	SourceQueue:  DefaultMQSourceQueue,
+	Destination:  DefaultMQDestination,
+}
+
+// environment 当前运行的环境，由ConfigureEnvironment设置
+var environment = defaultEnvironment
+
+// LoadEnvironments 加载环境配置文件，格式为 {"环境名": {"src": ..., "des": ...}}
+// path为空时只有内置环境
+func LoadEnvironments(path string) (map[string]EnvironmentProfile, error) {
+	environments := map[string]EnvironmentProfile{DefaultEnvironmentName: defaultEnvironment}
+	if path == "" {
+		return environments, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取环境配置失败: %v", err)
+	}
+	var profiles map[string]EnvironmentProfile
+	if err := json.Unmarshal(content, &profiles); err != nil {
+		return nil, fmt.Errorf("解析环境配置失败: %v", err)
+	}
+	for name, profile := range profiles {
+		profile.Name = name
+		profile.SRC = valueOrDefault(profile.SRC, defaultEnvironment.SRC)
+		profile.DES = valueOrDefault(profile.DES, defaultEnvironment.DES)
+		profile.APP = valueOrDefault(profile.APP, defaultEnvironment.APP)
+		profile.VER = valueOrDefault(profile.VER, defaultEnvironment.VER)
+		profile.QueueManager = valueOrDefault(profile.QueueManager, defaultEnvironment.QueueManager)
+		profile.SourceQueue = valueOrDefault(profile.SourceQueue, defaultEnvironment.SourceQueue)
+		profile.Destination = valueOrDefault(profile.Destination, defaultEnvironment.Destination)
+		environments[name] = profile
+	}
+	return environments, nil
+}
+
+// ConfigureEnvironment 按配置选择环境，每次转换运行开始时调用一次
+func ConfigureEnvironment(setting *Setting) error {
+	environments, err := LoadEnvironments(setting.EnvironmentsFile)
+	if err != nil {
+		return err
+	}
+	name := valueOrDefault(setting.Environment, DefaultEnvironmentName)
+	profile, ok := environments[name]
+	if !ok {
+		names := make([]string, 0, len(environments))
+		for n := range environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("环境[%s]不存在，可选环境: %s", name, strings.Join(names, ", "))
+	}
+	profile.selected = setting.Environment != ""
+	environment = profile
+	if !profile.selected {
+		AppLogger.Printf("未选择目标环境，报文头沿用源报文的节点代码")
+		return nil
+	}
+	AppLogger.Printf("目标环境: %s (SRC=%s, DES=%s)", profile.Name, profile.SRC, profile.DES)
+	return nil
+}
+
+// ApplyHead 按环境设置报文头的节点代码、应用名称和版本号，未明确选择环境时不修改
+func (env EnvironmentProfile) ApplyHead(head *HEAD) {
+	if !env.selected {
+		return
+	}
+	head.SRC = env.SRC
+	head.DES = env.DES
+	head.APP = env.APP
+	head.VER = env.VER
+}
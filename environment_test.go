@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestApplyHeadOnlyWhenSelected(t *testing.T) {
+	path := writeTestFile(t, "environments.json", `{"uat": {"src": "200000000000", "des": "444444444444"}}`)
+	defer ConfigureEnvironment(&Setting{})
+
+	source := HEAD{VER: "2.0", SRC: "900000000000", DES: "999999999999", APP: "SRC"}
+
+	// 未选择环境时沿用源报文的节点代码
+	if err := ConfigureEnvironment(&Setting{EnvironmentsFile: path}); err != nil {
+		t.Fatal(err)
+	}
+	head := source
+	environment.ApplyHead(&head)
+	if head != source {
+		t.Errorf("未选择环境时报文头被改写: %+v", head)
+	}
+
+	// 选择环境后按环境改写，未配置的项取内置环境的值
+	if err := ConfigureEnvironment(&Setting{EnvironmentsFile: path, Environment: "uat"}); err != nil {
+		t.Fatal(err)
+	}
+	head = source
+	environment.ApplyHead(&head)
+	want := HEAD{VER: defaultEnvironment.VER, SRC: "200000000000", DES: "444444444444", APP: defaultEnvironment.APP}
+	if head != want {
+		t.Errorf("ApplyHead = %+v, want %+v", head, want)
+	}
+
+	// 明确选择内置环境时同样改写
+	if err := ConfigureEnvironment(&Setting{Environment: DefaultEnvironmentName}); err != nil {
+		t.Fatal(err)
+	}
+	head = source
+	environment.ApplyHead(&head)
+	if head.SRC != defaultEnvironment.SRC || head.DES != defaultEnvironment.DES {
+		t.Errorf("选择default环境时 ApplyHead = %+v", head)
+	}
+
+	if err := ConfigureEnvironment(&Setting{EnvironmentsFile: path, Environment: "prod"}); err == nil {
+		t.Error("不存在的环境应报错")
+	}
+}
+
+func TestEnvironmentFeedsEnvelopeConfig(t *testing.T) {
+	path := writeTestFile(t, "environments.json", `{"uat": {"queue_manager": "QM_UAT"}}`)
+	setting := &Setting{EnvironmentsFile: path, Environment: "uat"}
+	defer ConfigureEnvironment(&Setting{})
+	defer ConfigureConversion(&Setting{})
+	if err := configureRun(setting); err != nil {
+		t.Fatal(err)
+	}
+	if envelopeConfig.QueueManager != "QM_UAT" {
+		t.Errorf("QueueManager = %s, want QM_UAT", envelopeConfig.QueueManager)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 字段映射规则类型
+const (
+	MappingConst  = "const"  // 常量
+	MappingField  = "field"  // 取6100源字段
+	MappingLookup = "lookup" // 以6100源字段为键查表
+	MappingGen    = "gen"    // 调用生成器
+)
+
+// FieldRule 单个7211字段的映射规则
+type FieldRule struct {
+	Type      string            `json:"type"`
+	Value     string            `json:"value,omitempty"`     // const: 常量值
+	Source    string            `json:"source,omitempty"`    // field/lookup: 6100源字段名（TaxBill6100或TaxHead6100中的字段）
+	Table     map[string]string `json:"table,omitempty"`     // lookup: 查找表
+	RefTable  string            `json:"ref_table,omitempty"` // lookup: 参考数据表名，查找表中没有时再查参考数据
+	Default   string            `json:"default,omitempty"`   // lookup: 查不到时的默认值
+	Generator string            `json:"generator,omitempty"` // gen: 生成器名称
+}
+
+// FieldMapping 7211字段名 -> 映射规则
+type FieldMapping map[string]FieldRule
+
+// mappingGenerators 映射文件中可用的生成器
+var mappingGenerators = map[string]ValueGenerator{
+	"tipsid":   GenerateUniqueTipsId,
+	"uniqueid": GenerateUniqueId,
+	"packno":   GeneratePackNo,
+	"trano":    GenerateTraNo,
+	"taxvouno": GenerateTaxVouNo,
+	"date":     BusinessDate,
+	"period":   PeriodDate,
+}
+
+// defaultFieldMapping7211 默认的6100->7211字段映射，保持原有的取值
+func defaultFieldMapping7211() FieldMapping {
+	return FieldMapping{
+		// TurnAccount7211
+		"BizType":      {Type: MappingConst, Value: "0"},
+		"FundSrlNo":    {Type: MappingGen, Generator: "uniqueid"},
+		"PayBnkNo":     {Type: MappingField, Source: "PayBkCode"},
+		"PayeeTreCode": {Type: MappingField, Source: "TreCode"},
+		"PayeeTreName": {Type: MappingLookup, Source: "TreCode", RefTable: RefTreasury, Default: "收款国库名称"},
+		// Payment7211
+		"TraNo":        {Type: MappingGen, Generator: "trano"},
+		"TraAmt":       {Type: MappingField, Source: "TaxAmt"},
+		"PayOpBnkNo":   {Type: MappingConst, Value: "319376074422"},
+		"PayOpBnkName": {Type: MappingConst, Value: "付款开户行名称"},
+		"HandOrgName":  {Type: MappingConst, Value: "缴款单位名称"},
+		"PayAcct":      {Type: MappingConst, Value: "9090313010010991008844"},
+		// TaxVou7211
+		"TaxVouNo":   {Type: MappingGen, Generator: "taxvouno"},
+		"BillDate":   {Type: MappingGen, Generator: "date"},
+		"TaxPayCode": {Type: MappingConst, Value: "123508214908270504"},
+		"TaxPayName": {Type: MappingConst, Value: "长汀县新桥中学"},
+		"BudgetType": {Type: MappingField, Source: "BudgetType"},
+		"TrimSign":   {Type: MappingField, Source: "TrimSign"},
+		// TaxType7211
+		"BudgetSubjectCode": {Type: MappingField, Source: "BudgetSubjectCode"},
+		"LimitDate":         {Type: MappingGen, Generator: "date"},
+		"BudgetLevelCode":   {Type: MappingField, Source: "BudgetLevelCode"},
+		"BudgetLevelName":   {Type: MappingLookup, Source: "BudgetLevelCode", RefTable: RefBudgetLevel, Default: "省"},
+		"TaxStartDate":      {Type: MappingGen, Generator: "period"},
+		"TaxEndDate":        {Type: MappingGen, Generator: "period"},
+		"ViceSign":          {Type: MappingField, Source: "ViceSign"},
+		"TaxType":           {Type: MappingConst, Value: "3"},
+		"HandBookKind":      {Type: MappingConst, Value: "3"},
+		// SubjectList7211
+		"TaxSubjectCode": {Type: MappingConst, Value: "11111111111111111111"},
+		"TaxSubjectName": {Type: MappingConst, Value: "税目111"},
+		"TaxNumber":      {Type: MappingConst, Value: "1"},
+		"TaxAmt":         {Type: MappingField, Source: "TaxAmt"},
+		"TaxRate":        {Type: MappingConst, Value: "1.00"},
+		"ExpTaxAmt":      {Type: MappingField, Source: "TaxAmt"},
+		"DiscountTaxAmt": {Type: MappingField, Source: "TaxAmt"},
+		"FactTaxAmt":     {Type: MappingField, Source: "TaxAmt"},
+	}
+}
+
+// ConfigureFieldMapping 按配置加载6100->7211字段映射，每次转换运行开始时调用一次
+func ConfigureFieldMapping(setting *Setting) error {
+	mapping, err := LoadFieldMapping7211(setting.Mapping7211File)
+	if err != nil {
+		return err
+	}
+	fieldMapping7211 = mapping
+	return nil
+}
+
+// LoadFieldMapping7211 加载6100->7211字段映射文件
+// 文件中只需配置需要覆盖的字段，未配置的字段使用默认映射；path为空时返回默认映射
+func LoadFieldMapping7211(path string) (FieldMapping, error) {
+	mapping := defaultFieldMapping7211()
+	if path == "" {
+		return mapping, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取字段映射文件失败: %v", err)
+	}
+	overrides := FieldMapping{}
+	if err := json.Unmarshal(content, &overrides); err != nil {
+		return nil, fmt.Errorf("解析字段映射文件失败: %v", err)
+	}
+
+	// 按字段名排序后校验，保证报错信息稳定
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := mapping[name]; !ok {
+			return nil, fmt.Errorf("字段映射文件错误: 7211不支持映射字段 %s", name)
+		}
+		if err := overrides[name].validate(); err != nil {
+			return nil, fmt.Errorf("字段映射文件错误: 字段 %s %v", name, err)
+		}
+		mapping[name] = overrides[name]
+	}
+	return mapping, nil
+}
+
+// validate 校验映射规则
+func (r FieldRule) validate() error {
+	switch r.Type {
+	case MappingConst:
+		return nil
+	case MappingField, MappingLookup:
+		if !isSourceField6100(r.Source) {
+			return fmt.Errorf("的源字段 %s 在6100中不存在", r.Source)
+		}
+		if r.RefTable != "" && !isReferenceTable(r.RefTable) {
+			return fmt.Errorf("的参考数据表 %s 不存在", r.RefTable)
+		}
+		return nil
+	case MappingGen:
+		if _, ok := mappingGenerators[strings.ToLower(r.Generator)]; !ok {
+			return fmt.Errorf("的生成器 %s 不存在", r.Generator)
+		}
+		return nil
+	default:
+		return fmt.Errorf("的映射类型 %s 不支持", r.Type)
+	}
+}
+
+// Value 按映射规则计算7211字段的值
+func (m FieldMapping) Value(name string, head *TaxHead6100, bill *TaxBill6100) string {
+	rule, ok := m[name]
+	if !ok {
+		return ""
+	}
+	switch rule.Type {
+	case MappingConst:
+		return rule.Value
+	case MappingField:
+		return sourceFieldValue6100(rule.Source, head, bill)
+	case MappingLookup:
+		key := sourceFieldValue6100(rule.Source, head, bill)
+		if value, ok := rule.Table[key]; ok {
+			return value
+		}
+		if value, ok := referenceData.Lookup(rule.RefTable, key); ok {
+			return value
+		}
+		return rule.Default
+	case MappingGen:
+		return mappingGenerators[strings.ToLower(rule.Generator)]()
+	default:
+		return ""
+	}
+}
+
+// IntValue 按映射规则计算7211整数字段的值，无法转换时返回0
+func (m FieldMapping) IntValue(name string, head *TaxHead6100, bill *TaxBill6100) int {
+	value, err := strconv.Atoi(strings.TrimSpace(m.Value(name, head, bill)))
+	if err != nil {
+		AppLogger.Printf("字段[%s]的映射值不是整数: %v", name, err)
+		return 0
+	}
+	return value
+}
+
+// AmountValue 按映射规则计算7211金额字段的值，合法金额统一格式化为两位小数，与批量头的AllAmt一致
+func (m FieldMapping) AmountValue(name string, head *TaxHead6100, bill *TaxBill6100) string {
+	value := m.Value(name, head, bill)
+	if amt, err := ParseAmount(value); err == nil {
+		return amt.String()
+	}
+	return value
+}
+
+// isSourceField6100 判断字段名是否为TaxBill6100或TaxHead6100的字段
+func isSourceField6100(name string) bool {
+	_, inBill := reflect.TypeOf(TaxBill6100{}).FieldByName(name)
+	_, inHead := reflect.TypeOf(TaxHead6100{}).FieldByName(name)
+	return name != "" && (inBill || inHead)
+}
+
+// sourceFieldValue6100 读取6100源字段的值，明细字段优先于报文头字段
+func sourceFieldValue6100(name string, head *TaxHead6100, bill *TaxBill6100) string {
+	if bill != nil {
+		if field := reflect.ValueOf(bill).Elem().FieldByName(name); field.IsValid() {
+			return field.String()
+		}
+	}
+	if head != nil {
+		if field := reflect.ValueOf(head).Elem().FieldByName(name); field.IsValid() {
+			return field.String()
+		}
+	}
+	return ""
+}
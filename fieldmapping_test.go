@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFile 在临时目录中写入测试文件并返回路径
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFieldMapping7211(t *testing.T) {
+	path := writeTestFile(t, "mapping.json", `{
+		"PayeeTreName": {"type": "const", "value": "福州国库"},
+		"PayBnkNo": {"type": "field", "source": "TreCode"},
+		"BudgetLevelName": {"type": "lookup", "source": "BudgetLevelCode", "table": {"1": "中央", "2": "省"}, "default": "其他"},
+		"TaxNumber": {"type": "const", "value": "3"}
+	}`)
+	mapping, err := LoadFieldMapping7211(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := &TaxHead6100{TreCode: "0100", PayBkCode: "313"}
+	tests := []struct {
+		name string
+		bill *TaxBill6100
+		want string
+	}{
+		{"PayeeTreName", nil, "福州国库"},
+		{"PayBnkNo", nil, "0100"},
+		{"BudgetLevelName", &TaxBill6100{BudgetLevelCode: "1"}, "中央"},
+		{"BudgetLevelName", &TaxBill6100{BudgetLevelCode: "9"}, "其他"},
+		// 未覆盖的字段使用默认映射
+		{"PayeeTreCode", nil, "0100"},
+		{"TraAmt", &TaxBill6100{TaxAmt: "1.50"}, "1.50"},
+		{"NotExist", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := mapping.Value(tt.name, head, tt.bill); got != tt.want {
+			t.Errorf("Value(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := mapping.IntValue("TaxNumber", head, nil); got != 3 {
+		t.Errorf("IntValue(TaxNumber) = %d, want 3", got)
+	}
+	if got := mapping.Value("TraNo", head, nil); got == "" {
+		t.Error("gen规则应生成值")
+	}
+
+	defaults, err := LoadFieldMapping7211("")
+	if err != nil || defaults.Value("PayeeTreName", head, nil) != "收款国库名称" {
+		t.Errorf("path为空时应返回默认映射: %v", err)
+	}
+}
+
+func TestLoadFieldMapping7211Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"未知字段", `{"Foo": {"type": "const", "value": "1"}}`, "不支持映射字段 Foo"},
+		{"源字段不存在", `{"PayBnkNo": {"type": "field", "source": "Foo"}}`, "源字段 Foo"},
+		{"lookup缺少源字段", `{"BudgetLevelName": {"type": "lookup"}}`, "源字段"},
+		{"生成器不存在", `{"TraNo": {"type": "gen", "generator": "foo"}}`, "生成器 foo"},
+		{"映射类型不支持", `{"TraNo": {"type": "script"}}`, "映射类型 script"},
+		{"JSON格式错误", `{"TraNo": `, "解析字段映射文件失败"},
+	}
+	for _, tt := range tests {
+		_, err := LoadFieldMapping7211(writeTestFile(t, "mapping.json", tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+	if _, err := LoadFieldMapping7211(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("映射文件不存在应报错")
+	}
+}
+
+func TestConfigureFieldMapping(t *testing.T) {
+	defer func(mapping FieldMapping) { fieldMapping7211 = mapping }(fieldMapping7211)
+
+	path := writeTestFile(t, "mapping.json", `{"PayeeTreName": {"type": "const", "value": "福州国库"}}`)
+	if err := ConfigureFieldMapping(&Setting{Mapping7211File: path}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fieldMapping7211.Value("PayeeTreName", nil, nil); got != "福州国库" {
+		t.Errorf("PayeeTreName = %q", got)
+	}
+	if err := ConfigureFieldMapping(&Setting{Mapping7211File: path + ".missing"}); err == nil {
+		t.Error("映射文件不存在应报错")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 过滤规则的匹配对象
+const (
+	FilterName  = "name"  // 文件名
+	FilterPath  = "path"  // 相对于输入目录的路径，以/分隔
+	FilterMsgNo = "msgno" // 报文编号
+)
+
+// defaultExcludePatterns 未配置排除规则时的默认排除规则：相对路径中含有 _3190_ 的文件（含子目录名）
+var defaultExcludePatterns = []string{"path:**_3190_**"}
+
+// filePattern 单条过滤规则，格式为 [name|path|msgno:][re:]模式
+// 默认匹配文件名；模式为glob（*不跨目录，**可跨目录），re:开头时为正则表达式
+type filePattern struct {
+	raw    string
+	target string
+	re     *regexp.Regexp
+}
+
+// FileFilter 输入文件的包含/排除过滤
+// 同一匹配对象配置了包含规则时须至少满足一条，不同匹配对象的包含规则须同时满足；满足任一排除规则即排除
+type FileFilter struct {
+	include []filePattern
+	exclude []filePattern
+}
+
+// NewFileFilter 根据配置创建文件过滤器，exclude为nil时使用默认排除规则
+func NewFileFilter(include, exclude []string) (*FileFilter, error) {
+	if exclude == nil {
+		exclude = defaultExcludePatterns
+	}
+	f := &FileFilter{}
+	for _, raw := range include {
+		p, err := parseFilePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			f.include = append(f.include, *p)
+		}
+	}
+	for _, raw := range exclude {
+		p, err := parseFilePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			f.exclude = append(f.exclude, *p)
+		}
+	}
+	return f, nil
+}
+
+// NewFileFilterFromSetting 根据配置项创建文件过滤器
+func NewFileFilterFromSetting(setting *Setting) (*FileFilter, error) {
+	return NewFileFilter(setting.IncludePatterns, setting.ExcludePatterns)
+}
+
+// fileFilter 当前运行的输入文件过滤器，为nil时不过滤
+var fileFilter *FileFilter
+
+// ConfigureFileFilter 按配置设置输入文件过滤，每次转换运行开始时调用一次
+func ConfigureFileFilter(setting *Setting) error {
+	filter, err := NewFileFilterFromSetting(setting)
+	if err != nil {
+		return err
+	}
+	fileFilter = filter
+	return nil
+}
+
+// parseFilePattern 解析过滤规则，空规则返回nil
+func parseFilePattern(raw string) (*filePattern, error) {
+	pattern := strings.TrimSpace(raw)
+	if pattern == "" {
+		return nil, nil
+	}
+	p := &filePattern{raw: pattern, target: FilterName}
+	for _, target := range []string{FilterName, FilterPath, FilterMsgNo} {
+		if rest, ok := strings.CutPrefix(pattern, target+":"); ok {
+			p.target, pattern = target, rest
+			break
+		}
+	}
+
+	expr := ""
+	if rest, ok := strings.CutPrefix(pattern, "re:"); ok {
+		expr = rest
+	} else {
+		expr = globToRegexp(pattern)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("文件过滤规则 %s 错误: %v", raw, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// globToRegexp 将glob转换为完整匹配的正则表达式
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// allow 按指定的匹配对象判断，返回是否通过及不通过的原因
+func (f *FileFilter) allow(values map[string]string) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	for _, p := range f.exclude {
+		if value, ok := values[p.target]; ok && p.re.MatchString(value) {
+			return false, "匹配排除规则 " + p.raw
+		}
+	}
+	for target, value := range values {
+		matched, hasInclude := false, false
+		for _, p := range f.include {
+			if p.target != target {
+				continue
+			}
+			hasInclude = true
+			if p.re.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if hasInclude && !matched {
+			return false, "不匹配" + target + "包含规则"
+		}
+	}
+	return true, ""
+}
+
+// AllowPath 按文件名和相对路径判断文件是否需要处理
+func (f *FileFilter) AllowPath(relPath string) (bool, string) {
+	relPath = filepath.ToSlash(relPath)
+	return f.allow(map[string]string{
+		FilterName: filepath.Base(relPath),
+		FilterPath: relPath,
+	})
+}
+
+// AllowMsgNo 按报文编号判断报文是否需要处理
+func (f *FileFilter) AllowMsgNo(msgNo string) (bool, string) {
+	return f.allow(map[string]string{FilterMsgNo: msgNo})
+}
+
+// FilePreview 预览中单个文件的处理结果
+type FilePreview struct {
+	Path    string
+	MsgNo   string
+	Process bool
+	Reason  string
+}
+
+// PreviewFiles 列出输入目录中会被处理的文件，不做任何修改
+// .enc文件需要解密后才能识别报文编号
+func PreviewFiles(root, encKey string, filter *FileFilter) ([]FilePreview, error) {
+	var previews []FilePreview
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || (ext != ".xml" && ext != ".enc") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		preview := FilePreview{Path: filepath.ToSlash(rel)}
+		if ok, reason := filter.AllowPath(rel); !ok {
+			preview.Reason = reason
+			previews = append(previews, preview)
+			return nil
+		}
+
+		msgNo, err := detectFileMsgNo(path, encKey)
+		if err != nil {
+			preview.Reason = err.Error()
+			previews = append(previews, preview)
+			return nil
+		}
+		preview.MsgNo = msgNo
+		preview.Process, preview.Reason = filter.AllowMsgNo(msgNo)
+		if _, ok := LookupConverter(msgNo); preview.Process && !ok {
+			preview.Process, preview.Reason = false, "不支持的报文类型"
+		}
+		previews = append(previews, preview)
+		return nil
+	})
+	return previews, err
+}
+
+// detectFileMsgNo 识别文件的报文编号
+func detectFileMsgNo(path, encKey string) (string, error) {
+	var content string
+	if strings.ToLower(filepath.Ext(path)) == ".enc" {
+		decrypted, err := DecryptFile(path, encKey)
+		if err != nil {
+			return "", fmt.Errorf("解密失败: %v", err)
+		}
+		content = decrypted
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		content, _, err = DecodeXMLBytes(data)
+		if err != nil {
+			return "", err
+		}
+	}
+	var cfx CFX
+	if err := unmarshalXMLString(content, &cfx); err != nil {
+		return "", fmt.Errorf("解析XML失败: %v", err)
+	}
+	return GetMsgType(&cfx), nil
+}
+
+// FormatFilePreview 生成预览文本
+func FormatFilePreview(previews []FilePreview) string {
+	var b strings.Builder
+	count := 0
+	for _, p := range previews {
+		if p.Process {
+			count++
+			fmt.Fprintf(&b, "[处理] %s (%s)\n", p.Path, p.MsgNo)
+		} else {
+			fmt.Fprintf(&b, "[跳过] %s (%s) %s\n", p.Path, p.MsgNo, p.Reason)
+		}
+	}
+	fmt.Fprintf(&b, "共%d个文件，处理%d个\n", len(previews), count)
+	return b.String()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		value string
+		want  bool
+	}{
+		{"*.xml", "a.xml", true},
+		{"*.xml", "a.xmlx", false},
+		{"*.xml", "sub/a.xml", false},
+		{"**.xml", "sub/a.xml", true},
+		{"sub/*.xml", "sub/a.xml", true},
+		{"sub/*.xml", "sub/x/a.xml", false},
+		{"sub/**/a.xml", "sub/x/y/a.xml", true},
+		{"a?.xml", "ab.xml", true},
+		{"a?.xml", "a/.xml", false},
+		{"a.xml", "abxml", false},
+		{"a+b(1).xml", "a+b(1).xml", true},
+		{"**_3190_**", "d/x_3190_1.xml", true},
+		{"**_3190_**", "d_3190_x/a.xml", true},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile(globToRegexp(tt.glob))
+		if got := re.MatchString(tt.value); got != tt.want {
+			t.Errorf("%s 匹配 %s = %v, want %v", tt.glob, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFileFilterIncludeExclude(t *testing.T) {
+	filter, err := NewFileFilter(
+		[]string{"*.xml", "re:^b", "path:in/**", "msgno:7221", "msgno:6100"},
+		[]string{"*_skip*", "path:in/old/**"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []struct {
+		path string
+		want bool
+	}{
+		{"in/a.xml", true},       // 满足文件名的任一包含规则和路径包含规则
+		{"in/b.enc", true},       // 文件名满足 re:^b
+		{"in/c.enc", false},      // 文件名不满足任何包含规则
+		{"out/a.xml", false},     // 路径不满足包含规则
+		{"in/a_skip.xml", false}, // 排除规则优先于包含规则
+		{"in/old/a.xml", false},  // 路径排除规则
+		{filepath.Join("in", "d.xml"), true},
+	}
+	for _, tt := range paths {
+		if got, reason := filter.AllowPath(tt.path); got != tt.want {
+			t.Errorf("AllowPath(%s) = %v (%s), want %v", tt.path, got, reason, tt.want)
+		}
+	}
+	for msgNo, want := range map[string]bool{"7221": true, "6100": true, "3190": false} {
+		if got, _ := filter.AllowMsgNo(msgNo); got != want {
+			t.Errorf("AllowMsgNo(%s) = %v, want %v", msgNo, got, want)
+		}
+	}
+
+	if _, err := NewFileFilter([]string{"re:("}, nil); err == nil {
+		t.Error("错误的正则表达式应报错")
+	}
+}
+
+func TestFileFilterDefaultExclude(t *testing.T) {
+	filter, err := NewFileFilter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		"a.xml":              true,
+		"a_3190_1.xml":       false,
+		"sub/a_3190_1.xml":   false,
+		"batch_3190_x/a.xml": false,
+		"a3190.xml":          true,
+	} {
+		if got, _ := filter.AllowPath(path); got != want {
+			t.Errorf("默认规则 AllowPath(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	// 配置为空数组时不使用默认排除规则
+	filter, err = NewFileFilter(nil, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := filter.AllowPath("a_3190_1.xml"); !ok {
+		t.Error("排除规则为空数组时不应排除")
+	}
+
+	var nilFilter *FileFilter
+	if ok, _ := nilFilter.AllowPath("a_3190_1.xml"); !ok {
+		t.Error("nil过滤器不应排除")
+	}
+}
+
+func TestPreviewFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a/7221.xml", `<?xml version="1.0" encoding="UTF-8"?><CFX><HEAD><MsgNo>7221</MsgNo></HEAD><MSG><BatchHead7221></BatchHead7221></MSG></CFX>`)
+	write("a/9120.xml", `<?xml version="1.0" encoding="UTF-8"?><CFX><HEAD><MsgNo>9120</MsgNo></HEAD><MSG></MSG></CFX>`)
+	write("b/x_3190_1.xml", `<?xml version="1.0" encoding="UTF-8"?><CFX/>`)
+	write("b/readme.txt", "")
+
+	filter, err := NewFileFilter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previews, err := PreviewFiles(dir, "", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"a/7221.xml": true, "a/9120.xml": false, "b/x_3190_1.xml": false}
+	if len(previews) != len(want) {
+		t.Fatalf("预览 = %+v", previews)
+	}
+	for _, p := range previews {
+		if p.Process != want[p.Path] {
+			t.Errorf("%s: Process = %v (%s), want %v", p.Path, p.Process, p.Reason, want[p.Path])
+		}
+	}
+}
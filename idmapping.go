@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SourceRef 输出报文中一条明细对应的源标识
+type SourceRef struct {
+	MsgID       string
+	PackNo      string
+	TraNo       string
+	ExpTaxVouNo string
+}
+
+// IdMapping 源标识与生成标识的对应关系，每条明细一行
+type IdMapping struct {
+	SourceFile        string `json:"sourceFile"`
+	OutputFile        string `json:"outputFile"`
+	SourceMsgID       string `json:"sourceMsgId"`
+	SourcePackNo      string `json:"sourcePackNo"`
+	SourceTraNo       string `json:"sourceTraNo"`
+	SourceExpTaxVouNo string `json:"sourceExpTaxVouNo"`
+	MsgNo             string `json:"msgNo"`
+	MsgID             string `json:"msgId"`
+	MsgRef            string `json:"msgRef"`
+	PackNo            string `json:"packNo"`
+	FundSrlNo         string `json:"fundSrlNo"`
+	TraNo             string `json:"traNo"`
+	TaxVouNo          string `json:"taxVouNo"`
+}
+
+// IdMappingFileName 标识对应关系文件名（不含扩展名）
+const IdMappingFileName = "id_mapping"
+
+var idMappingCSVHeader = []string{
+	"SourceFile", "OutputFile", "SourceMsgID", "SourcePackNo", "SourceTraNo", "SourceExpTaxVouNo",
+	"MsgNo", "MsgID", "MsgRef", "PackNo", "FundSrlNo", "TraNo", "TaxVouNo",
+}
+
+// BuildIdMappings 根据最终的输出报文和明细源标识生成对应关系
+// 明细按输出报文中的顺序与 data.SourceRefs 一一对应
+func BuildIdMappings(sourceFile, outputFile string, data *OutputData) []IdMapping {
+	if data.Cfx == nil {
+		return nil
+	}
+	base := IdMapping{
+		SourceFile: sourceFile,
+		OutputFile: outputFile,
+		MsgNo:      data.Cfx.HEAD.MsgNo,
+		MsgID:      data.Cfx.HEAD.MsgID,
+		MsgRef:     data.Cfx.HEAD.MsgRef,
+	}
+	sourceRef := func(i int) SourceRef {
+		if i < len(data.SourceRefs) {
+			return data.SourceRefs[i]
+		}
+		return SourceRef{}
+	}
+	withSource := func(row IdMapping, ref SourceRef) IdMapping {
+		row.SourceMsgID = ref.MsgID
+		row.SourcePackNo = ref.PackNo
+		row.SourceTraNo = ref.TraNo
+		row.SourceExpTaxVouNo = ref.ExpTaxVouNo
+		return row
+	}
+
+	var rows []IdMapping
+	msg := data.Cfx.MSG
+	switch {
+	case msg.BatchHead7221 != nil:
+		base.PackNo = msg.BatchHead7221.PackNo
+		if msg.DrawbackBody7221 != nil {
+			for i, info := range msg.DrawbackBody7221.DrawbackInfo7221 {
+				row := withSource(base, sourceRef(i))
+				row.TraNo = info.TraNo
+				rows = append(rows, row)
+			}
+		}
+	case msg.BatchHead7211 != nil:
+		base.PackNo = msg.BatchHead7211.PackNo
+		if msg.TurnAccount7211 != nil {
+			base.FundSrlNo = msg.TurnAccount7211.FundSrlNo
+		}
+		if msg.TaxBody7211 != nil {
+			for i, info := range msg.TaxBody7211.TaxInfo7211 {
+				row := withSource(base, sourceRef(i))
+				row.TraNo = info.Payment7211.TraNo
+				row.TaxVouNo = info.TaxVou7211.TaxVouNo
+				rows = append(rows, row)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		rows = append(rows, withSource(base, sourceRef(0)))
+	}
+	return rows
+}
+
+// WriteIdMappings 将本次运行的标识对应关系写入目录下的 id_mapping.csv 和 id_mapping.json
+func WriteIdMappings(dir string, mappings []IdMapping) error {
+	rows := make([][]string, 0, len(mappings))
+	for _, m := range mappings {
+		rows = append(rows, []string{
+			m.SourceFile, m.OutputFile, m.SourceMsgID, m.SourcePackNo, m.SourceTraNo, m.SourceExpTaxVouNo,
+			m.MsgNo, m.MsgID, m.MsgRef, m.PackNo, m.FundSrlNo, m.TraNo, m.TaxVouNo,
+		})
+	}
+	if err := writeExcelCSV(filepath.Join(dir, IdMappingFileName+".csv"), idMappingCSVHeader, rows); err != nil {
+		return fmt.Errorf("写入标识对应关系文件失败: %v", err)
+	}
+
+	content, err := json.MarshalIndent(mappings, "", "  ")
+	if err != nil {
+		return err
+	}
+	jsonPath := filepath.Join(dir, IdMappingFileName+".json")
+	if err := os.WriteFile(jsonPath, content, 0644); err != nil {
+		return fmt.Errorf("写入标识对应关系文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildIdMappings7221(t *testing.T) {
+	data := &OutputData{
+		Cfx: &CFX{
+			HEAD: HEAD{MsgNo: "7221", MsgID: "M1", MsgRef: "M1"},
+			MSG: MSG{
+				BatchHead7221: &BatchHead7221{PackNo: "P1"},
+				DrawbackBody7221: &DrawbackBody7221{DrawbackInfo7221: []DrawbackInfo7221{
+					{TraNo: "N1"}, {TraNo: "N2"},
+				}},
+			},
+		},
+		SourceRefs: []SourceRef{
+			{MsgID: "S1", PackNo: "SP", TraNo: "T1"},
+			{MsgID: "S1", PackNo: "SP", TraNo: "T2"},
+		},
+	}
+	rows := BuildIdMappings("in.xml", "out.xml", data)
+	if len(rows) != 2 {
+		t.Fatalf("行数 = %d, 期望 2", len(rows))
+	}
+	want := IdMapping{
+		SourceFile: "in.xml", OutputFile: "out.xml",
+		SourceMsgID: "S1", SourcePackNo: "SP", SourceTraNo: "T2",
+		MsgNo: "7221", MsgID: "M1", MsgRef: "M1", PackNo: "P1", TraNo: "N2",
+	}
+	if rows[1] != want {
+		t.Errorf("第2行 = %+v, 期望 %+v", rows[1], want)
+	}
+}
+
+func TestBuildIdMappings7211(t *testing.T) {
+	data := &OutputData{
+		Cfx: &CFX{
+			HEAD: HEAD{MsgNo: "7211", MsgID: "M2"},
+			MSG: MSG{
+				BatchHead7211:   &BatchHead7211{PackNo: "P2"},
+				TurnAccount7211: &TurnAccount7211{FundSrlNo: "F1"},
+				TaxBody7211: &TaxBody7211{TaxInfo7211: []TaxInfo7211{
+					{Payment7211: Payment7211{TraNo: "N1"}, TaxVou7211: TaxVou7211{TaxVouNo: "V1"}},
+				}},
+			},
+		},
+		SourceRefs: []SourceRef{{MsgID: "S2", ExpTaxVouNo: "E1"}},
+	}
+	rows := BuildIdMappings("in.xml", "out.xml", data)
+	if len(rows) != 1 {
+		t.Fatalf("行数 = %d, 期望 1", len(rows))
+	}
+	row := rows[0]
+	if row.PackNo != "P2" || row.FundSrlNo != "F1" || row.TraNo != "N1" || row.TaxVouNo != "V1" ||
+		row.SourceMsgID != "S2" || row.SourceExpTaxVouNo != "E1" {
+		t.Errorf("对应关系 = %+v", row)
+	}
+}
+
+func TestBuildIdMappingsWithoutDetails(t *testing.T) {
+	data := &OutputData{
+		Cfx:        &CFX{HEAD: HEAD{MsgNo: "9120", MsgID: "M3"}},
+		SourceRefs: []SourceRef{{MsgID: "S3"}},
+	}
+	rows := BuildIdMappings("in.xml", "out.xml", data)
+	if len(rows) != 1 || rows[0].MsgID != "M3" || rows[0].SourceMsgID != "S3" {
+		t.Errorf("没有明细时应生成一行报文级对应关系, 实际 %+v", rows)
+	}
+	if rows := BuildIdMappings("in.xml", "out.xml", &OutputData{}); rows != nil {
+		t.Errorf("没有报文结构时不应生成对应关系, 实际 %+v", rows)
+	}
+}
+
+func TestWriteIdMappings(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "report")
+	mappings := []IdMapping{
+		{SourceFile: "a.xml", OutputFile: "b.xml", SourceTraNo: "T1", MsgNo: "7221", TraNo: "N1"},
+		{SourceFile: "a.xml", OutputFile: "b.xml", SourceTraNo: "T2", MsgNo: "7221", TraNo: "N2"},
+	}
+	if err := WriteIdMappings(dir, mappings); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, IdMappingFileName+".csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(content, utf8BOM) {
+		t.Error("CSV文件应以UTF-8 BOM开头")
+	}
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, utf8BOM))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "SourceFile" || records[2][4] != "T2" || records[2][11] != "N2" {
+		t.Errorf("CSV内容 = %v", records)
+	}
+
+	content, err = os.ReadFile(filepath.Join(dir, IdMappingFileName+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []IdMapping
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[1] != mappings[1] {
+		t.Errorf("JSON内容 = %+v", decoded)
+	}
+}
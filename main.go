@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"github.com/rivo/tview"
 	"github.com/sqweek/dialog"
-	"golang.org/x/text/encoding/simplifiedchinese"
 	"io"
 	"io/ioutil"
 	"os"
@@ -29,18 +28,20 @@ const Convert = "转换"
 const UseTestFun = false
 
 type StatisticsData struct {
-	SedMsg7211Count  uint64
-	SedMsg7221Count  uint64
-	DecryptFileCount uint64
-	ConvertFileCount uint64
-	Detail7211Count  uint64
-	Detail7221Count  uint64
+	SedMsg7211Count      uint64
+	SedMsg7221Count      uint64
+	DecryptFileCount     uint64
+	ConvertFileCount     uint64
+	Detail7211Count      uint64
+	Detail7221Count      uint64
+	InvalidMsgCount      uint64
+	UnsupportedFileCount uint64
 }
 
 /**
 * 解密文件
  */
-func decryptFiles(originalFilePath string, encKey string, staticsData *StatisticsData) (string, error) {
+func decryptFiles(originalFilePath string, encKey string, filter *FileFilter, staticsData *StatisticsData) (string, error) {
 	// 获取解密后目录：与setting.OriginalFilePathh平级的新目录
 	AppLogger.Printf("创建解密后的文件目录")
 	baseDir := filepath.Dir(originalFilePath)                                                                              // 获取setting.OriginalFilePath的上级目录
@@ -62,11 +63,28 @@ func decryptFiles(originalFilePath string, encKey string, staticsData *Statistic
 			AppLogger.Printf("遍历原始数据目录失败, 原始数据目录：%s, 错误原因：%v", originalFilePath, err)
 			return err
 		}
+		if info.IsDir() {
+			return nil
+		}
+		// 按文件名、相对路径过滤，解密后的目录保持原有的子目录结构
+		relPath, err := filepath.Rel(originalFilePath, path)
+		if err != nil {
+			return err
+		}
+		if ok, reason := filter.AllowPath(relPath); !ok {
+			AppLogger.Printf("跳过文件 %s: %s", path, reason)
+			return nil
+		}
+		targetSubDir := filepath.Join(targetDir, filepath.Dir(relPath))
+		if err := os.MkdirAll(targetSubDir, 0755); err != nil {
+			AppLogger.Printf("创建目录失败: %v", err)
+			return err
+		}
 		AppLogger.Printf("开始解密文件: %s", path)
 		// 如果为xml文件，直接将此文件复制到setting.OriginalFilePath目录平级的目录里面
-		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".xml" {
+		if strings.ToLower(filepath.Ext(path)) == ".xml" {
 			// 构建目标文件路径
-			targetFilePath := filepath.Join(targetDir, filepath.Base(path))
+			targetFilePath := filepath.Join(targetSubDir, filepath.Base(path))
 
 			// 复制文件
 			err = copyFile(path, targetFilePath)
@@ -80,7 +98,7 @@ func decryptFiles(originalFilePath string, encKey string, staticsData *Statistic
 			AppLogger.Printf("文件已复制: %s -> %s", path, targetFilePath)
 		}
 		// 如果为enc文件，需要解密后转为xml文件，再保存到setting.OriginalFilePath目录平级的目录里面
-		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".enc" {
+		if strings.ToLower(filepath.Ext(path)) == ".enc" {
 			decryptedText, err := DecryptFile(path, encKey)
 			if err != nil {
 				AppLogger.Printf("解密文件失败: %v", err)
@@ -88,7 +106,7 @@ func decryptFiles(originalFilePath string, encKey string, staticsData *Statistic
 			}
 			// 构建目标文件路径，将.enc扩展名改为.xml
 			baseName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".xml"
-			targetFilePath := filepath.Join(targetDir, baseName)
+			targetFilePath := filepath.Join(targetSubDir, baseName)
 			// 保存解密后的文件
 			err = SaveFile(decryptedText, targetFilePath)
 			if err != nil {
@@ -130,7 +148,79 @@ func copyFile(src, dst string) error {
 	return err
 }
 
-func convertFiles(decryptedFilePath string, originalFilePath string, payeeOpBkCode string, staticsData *StatisticsData) (string, error) {
+// configureRun 按配置设置本次运行的全局状态，每次运行开始时调用一次
+// 合成报文生成和转换共用同一份配置，ID生成器只在这里播种一次
+func configureRun(setting *Setting) error {
+	// 按配置设置业务时钟和ID生成器（确定性模式）
+	err := ConfigureDeterministic(setting)
+	if err != nil {
+		AppLogger.Printf("设置确定性模式失败: %v", err)
+		return err
+	}
+	// 按配置设置业务日期平移
+	err = ConfigureDateShift(setting)
+	if err != nil {
+		AppLogger.Printf("设置业务日期平移失败: %v", err)
+		return err
+	}
+	// 按配置选择目标环境，需在转换参数之前：MQ信封等配置取环境覆盖后的值
+	err = ConfigureEnvironment(setting)
+	if err != nil {
+		AppLogger.Printf("设置目标环境失败: %v", err)
+		return err
+	}
+	// 按配置加载参考数据
+	err = ConfigureReferenceData(setting)
+	if err != nil {
+		AppLogger.Printf("加载参考数据失败: %v", err)
+		return err
+	}
+	// 按配置设置数据脱敏
+	err = ConfigureMasking(setting)
+	if err != nil {
+		AppLogger.Printf("设置数据脱敏失败: %v", err)
+		return err
+	}
+	// 按配置设置转换参数
+	err = ConfigureConversion(setting)
+	if err != nil {
+		AppLogger.Printf("设置转换参数失败: %v", err)
+		return err
+	}
+	// 按配置加载6100->7211字段映射
+	err = ConfigureFieldMapping(setting)
+	if err != nil {
+		AppLogger.Printf("加载字段映射失败: %v", err)
+		return err
+	}
+	// 按配置加载校验规则
+	err = ConfigureValidation(setting)
+	if err != nil {
+		AppLogger.Printf("加载校验规则失败: %v", err)
+		return err
+	}
+	// 按配置加载报文模板
+	err = ConfigureTemplates(setting)
+	if err != nil {
+		AppLogger.Printf("加载报文模板失败: %v", err)
+		return err
+	}
+	// 按配置加载字段覆盖规则
+	err = ConfigureOverrides(setting)
+	if err != nil {
+		AppLogger.Printf("加载字段覆盖规则失败: %v", err)
+		return err
+	}
+	// 按配置设置输入文件过滤
+	err = ConfigureFileFilter(setting)
+	if err != nil {
+		AppLogger.Printf("文件过滤规则错误: %v", err)
+		return err
+	}
+	return nil
+}
+
+func convertFiles(decryptedFilePath string, originalFilePath string, setting *Setting, staticsData *StatisticsData) (string, error) {
 	// 获取解密后目录：与settingDecryptedFilePath平级的新目录
 	AppLogger.Printf("创建转换后的文件目录")
 	baseDir := filepath.Dir(decryptedFilePath) // 获取上级目录
@@ -148,6 +238,13 @@ func convertFiles(decryptedFilePath string, originalFilePath string, payeeOpBkCo
 		AppLogger.Printf("创建目录失败: %v", err)
 		return "", err
 	}
+	// 校验不通过的报文目录、运行报告目录，与转换目录平级
+	invalidDir := targetDir + "_invalid"
+	reportDir := targetDir + "_report"
+	var validationReport strings.Builder
+	idMappings := []IdMapping{}
+	var envelopes []EnvelopeRecord
+	var reconcileRows []ReconcileRow
 
 	err = filepath.Walk(decryptedFilePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -156,24 +253,83 @@ func convertFiles(decryptedFilePath string, originalFilePath string, payeeOpBkCo
 		}
 		AppLogger.Printf("开始转换文件: %s", path)
 		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".xml" {
-			outputDatas, err := ConvertMsg(path, payeeOpBkCode)
+			// 按文件名、相对路径过滤
+			relPath, err := filepath.Rel(decryptedFilePath, path)
+			if err != nil {
+				return err
+			}
+			if ok, reason := fileFilter.AllowPath(relPath); !ok {
+				AppLogger.Printf("跳过文件 %s: %s", path, reason)
+				return nil
+			}
+			outputDatas, err := ConvertMsg(path, setting)
+			var unsupportedErr *UnsupportedMsgTypeError
+			if errors.As(err, &unsupportedErr) {
+				// 不支持的报文类型记录后跳过，不中断转换
+				AppLogger.Printf("跳过文件 %s: %v", path, err)
+				atomic.AddUint64(&staticsData.UnsupportedFileCount, 1)
+				return nil
+			}
 			if err != nil {
 				AppLogger.Printf("转换文件失败: %v", err)
 				return err
 			}
+			// 对账：源报文与输出报文的笔数、金额不一致时，该文件的报文都不参与发送
+			var reconcileReport string
+			if len(outputDatas) > 0 {
+				rows, err := Reconcile(path, outputDatas[0].Source, outputDatas)
+				if err != nil {
+					AppLogger.Printf("对账失败: %v", err)
+					return err
+				}
+				reconcileRows = append(reconcileRows, rows...)
+				reconcileReport = FormatReconcileReport(rows)
+				if reconcileReport != "" {
+					AppLogger.Printf("文件 %s 对账不一致，转换后的报文不参与发送", path)
+					validationReport.WriteString(reconcileReport)
+				}
+			}
 			count := 0
 			for _, outputData := range outputDatas {
 				AppLogger.Printf("开始保存转换后的文件")
-				// 构建目标文件路径
-				targetFilePath := filepath.Join(targetDir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+fmt.Sprintf("_%d.xml", count))
+				// 构建目标文件路径，保留相对于解密目录的子目录，避免不同子目录下的同名文件互相覆盖
+				fileName := filepath.ToSlash(strings.TrimSuffix(relPath, filepath.Ext(relPath))) + fmt.Sprintf("_%d.xml", count)
 				if len(outputDatas) == 1 {
-					targetFilePath = filepath.Join(targetDir, filepath.Base(path))
+					fileName = filepath.ToSlash(relPath)
+				}
+				targetFilePath := filepath.Join(targetDir, filepath.FromSlash(fileName))
+				idMappings = append(idMappings, BuildIdMappings(path, fileName, outputData)...)
+				// 校验不通过或对账不一致的报文保存到单独的目录，不参与发送
+				if len(outputData.ValidationErrors) > 0 || reconcileReport != "" {
+					AppLogger.Printf("报文校验不通过: %s", fileName)
+					targetFilePath = filepath.Join(invalidDir, filepath.FromSlash(fileName))
+					if err := os.MkdirAll(filepath.Dir(targetFilePath), 0755); err != nil {
+						AppLogger.Printf("创建目录失败: %v", err)
+						return err
+					}
+					if len(outputData.ValidationErrors) > 0 {
+						validationReport.WriteString(FormatValidationReport(path, fileName, outputData))
+					}
+					atomic.AddUint64(&staticsData.InvalidMsgCount, 1)
+					err := ioutil.WriteFile(targetFilePath, []byte(outputData.Body), 0644)
+					if err != nil {
+						AppLogger.Printf("写入文件失败: %v", err)
+					}
+					count++
+					continue
 				}
 				// 保存文件
-				err := ioutil.WriteFile(targetFilePath, []byte(outputData.Item8), 0644)
+				if err := os.MkdirAll(filepath.Dir(targetFilePath), 0755); err != nil {
+					AppLogger.Printf("创建目录失败: %v", err)
+					return err
+				}
+				err := ioutil.WriteFile(targetFilePath, []byte(outputData.Body), 0644)
 				if err != nil {
 					AppLogger.Printf("写入文件失败: %v", err)
 				} else {
+					if setting.ExportEnvelopes {
+						envelopes = append(envelopes, NewEnvelopeRecord(fileName, outputData))
+					}
 					atomic.AddUint64(&staticsData.ConvertFileCount, 1)
 					// 将明细数进行累加
 					atomic.AddUint64(&staticsData.Detail7211Count, uint64(outputData.Detail7211Count))
@@ -192,6 +348,48 @@ func convertFiles(decryptedFilePath string, originalFilePath string, payeeOpBkCo
 		AppLogger.Printf("转换文件失败: %v", err)
 		return "", err
 	}
+
+	// 输出源标识与生成标识的对应关系
+	err = WriteIdMappings(reportDir, idMappings)
+	if err != nil {
+		AppLogger.Printf("写入标识对应关系失败: %v", err)
+		return "", err
+	}
+	AppLogger.Printf("标识对应关系已保存到: %s", reportDir)
+
+	// 输出对账报告
+	err = WriteReconciliation(reportDir, reconcileRows)
+	if err != nil {
+		AppLogger.Printf("写入对账报告失败: %v", err)
+		return "", err
+	}
+
+	// 输出参考数据中查不到的代码
+	err = referenceData.WriteReferenceMissing(reportDir)
+	if err != nil {
+		AppLogger.Printf("写入参考数据缺失报告失败: %v", err)
+		return "", err
+	}
+
+	// 导出报文信封（MQ头信息+报文体）
+	if setting.ExportEnvelopes {
+		err = WriteEnvelopes(reportDir, envelopes)
+		if err != nil {
+			AppLogger.Printf("导出报文信封失败: %v", err)
+			return "", err
+		}
+	}
+
+	// 输出校验报告
+	if validationReport.Len() > 0 {
+		reportPath := filepath.Join(invalidDir, "validation_report.txt")
+		err = os.WriteFile(reportPath, []byte(validationReport.String()), 0644)
+		if err != nil {
+			AppLogger.Printf("写入校验报告失败: %v", err)
+			return "", err
+		}
+		AppLogger.Printf("存在校验不通过的报文，校验报告: %s", reportPath)
+	}
 	return targetDir, nil
 }
 
@@ -201,6 +399,8 @@ func handleMsg(ctx context.Context, id int, setting *Setting, staticsData *Stati
 		AppLogger.Printf("Worker %d create CFMQ clinet error: %s\n", id, err)
 	}
 	client.SedQueueTips = setting.SedQueueTips
+	client.TipsCharset = charsetOrDefault(setting.TipsCharset, DefaultCharset)
+	client.CtbsCharset = charsetOrDefault(setting.CtbsCharset, CharsetUTF8)
 	err = client.CreateQueue(client.SedQueueTips)
 	if err != nil {
 		AppLogger.Printf("Worker %d create sed queue tips error: %s\n", id, err)
@@ -208,18 +408,40 @@ func handleMsg(ctx context.Context, id int, setting *Setting, staticsData *Stati
 	defer client.Logout()
 	go client.HeartBeat(ctx)
 
-	// 解密
-	decryptedFilePath, err := decryptFiles(setting.FilePath, setting.EncKey, staticsData)
-	if decryptedFilePath == "" || err != nil {
-		AppLogger.Printf("Worker %d decrypt error: %s\n", id, err)
+	// 设置本次运行的全局状态
+	if err := configureRun(setting); err != nil {
+		AppLogger.Printf("Worker %d configure error: %s\n", id, err)
 		return
 	}
 
+	// 解密；配置了合成报文时不读取原始文件，按配置生成源报文
+	var decryptedFilePath, originalFilePath string
+	if setting.SyntheticProfile != "" {
+		decryptedFilePath, err = GenerateSyntheticFiles(setting)
+		if err != nil {
+			AppLogger.Printf("Worker %d synthetic error: %s\n", id, err)
+			return
+		}
+		originalFilePath = decryptedFilePath
+	} else {
+		filter, err := NewFileFilterFromSetting(setting)
+		if err != nil {
+			AppLogger.Printf("文件过滤规则错误: %v", err)
+			return
+		}
+		decryptedFilePath, err = decryptFiles(setting.FilePath, setting.EncKey, filter, staticsData)
+		if decryptedFilePath == "" || err != nil {
+			AppLogger.Printf("Worker %d decrypt error: %s\n", id, err)
+			return
+		}
+		originalFilePath = setting.FilePath
+	}
+
 	// 等待3秒
 	time.Sleep(3 * time.Second)
 
 	// 转换
-	convertedFilePath, err := convertFiles(decryptedFilePath, setting.FilePath, setting.PayeeOpBkCode, staticsData)
+	convertedFilePath, err := convertFiles(decryptedFilePath, originalFilePath, setting, staticsData)
 	if convertedFilePath == "" || err != nil {
 		AppLogger.Printf("Worker %d convert error: %s\n", id, err)
 		return
@@ -283,7 +505,7 @@ func handleMsg(ctx context.Context, id int, setting *Setting, staticsData *Stati
 				return err
 			}
 			// 获取报文头
-			msgNo, _ := getXMLFieldValue(msg, "MsgNo")
+			msgNo, _ := getXMLFieldValue(msg, "HEAD/MsgNo")
 			AppLogger.Printf("获取报文类型：%s\n", msgNo)
 			if err != nil {
 				return err
@@ -355,14 +577,13 @@ func processSingleXMLFile(filePath string) (string, error) {
 		return "", err
 	}
 
-	// 使用GBK解码器将字节数据解码为UTF-8字符串
-	decoder := simplifiedchinese.GBK.NewDecoder()
-	utf8Data, err := decoder.Bytes(data)
+	// 按XML声明（或自动检测）的字符集将字节数据解码为UTF-8字符串
+	utf8Data, _, err := DecodeXMLBytes(data)
 	if err != nil {
 		return "", err
 	}
 
-	return string(utf8Data), nil
+	return utf8Data, nil
 }
 
 func processSingleXMLFileToStruct(filePath string) (*BaseMsg, error) {
@@ -379,68 +600,34 @@ func processSingleXMLFileToStruct(filePath string) (*BaseMsg, error) {
 // ValueGenerator 定义生成值的函数类型
 type ValueGenerator func() string
 
-/**
-* 替换XML文件中的字段值，传入数值生成函数，返回替换后的XML文件内容
- */
-func replaceXMLField(xmlData string, fieldName string, generator ValueGenerator) string {
-	startTag := "<" + fieldName + ">"
-	endTag := "</" + fieldName + ">"
-
-	result := xmlData
-	offset := 0
-
-	for {
-		startIdx := strings.Index(result[offset:], startTag)
-		if startIdx == -1 {
-			break
-		}
-		startIdx += offset
-
-		endIdx := strings.Index(result[startIdx:], endTag)
-		if endIdx == -1 {
-			break
-		}
-		endIdx += startIdx
-
-		// 生成新的值
-		newValue := generator()
-
-		// 替换字段值
-		prefix := result[:startIdx+len(startTag)]
-		suffix := result[endIdx:]
-		result = prefix + newValue + suffix
-
-		// 更新偏移量以继续查找下一个匹配项
-		offset = startIdx + len(startTag) + len(newValue) + len(endTag)
-
-		// 防止无限循环的安全检查
-		if offset >= len(result) {
-			break
-		}
+// replaceXMLField 替换XML中路径匹配的全部元素的值，每个元素调用一次生成函数，返回替换后的XML内容
+// 不含/的字段名匹配任意层级的同名元素；XML解析失败时原样返回
+func replaceXMLField(xmlData string, path string, generator ValueGenerator) string {
+	editor, err := NewXMLEditor(xmlData)
+	if err != nil {
+		AppLogger.Printf("替换字段[%s]失败: %v", path, err)
+		return xmlData
 	}
-
-	return result
+	if _, err := editor.SetFunc(normalizeOverridePath(path), generator); err != nil {
+		AppLogger.Printf("替换字段[%s]失败: %v", path, err)
+		return xmlData
+	}
+	return editor.String()
 }
 
 // replaceXMLFieldWithValue 使用固定值替换（保持向后兼容）
-func replaceXMLFieldWithValue(xmlData, fieldName, newValue string) string {
-	return replaceXMLField(xmlData, fieldName, func() string { return newValue })
+func replaceXMLFieldWithValue(xmlData, path, newValue string) string {
+	return replaceXMLField(xmlData, path, func() string { return newValue })
 }
 
-// 从xml文件中读取某个fieldName对应的值
-func getXMLFieldValue(xmlData, fieldName string) (string, error) {
-	startTag := "<" + fieldName + ">"
-	endTag := "</" + fieldName + ">"
-	startIdx := strings.Index(xmlData, startTag)
-	if startIdx == -1 {
-		return "", errors.New("field not found")
-	}
-	endIdx := strings.Index(xmlData, endTag)
-	if endIdx == -1 {
-		return "", errors.New("end tag not found")
+// getXMLFieldValue 读取XML中路径匹配的第一个元素的值
+// 不含/的字段名匹配任意层级的同名元素
+func getXMLFieldValue(xmlData, path string) (string, error) {
+	editor, err := NewXMLEditor(xmlData)
+	if err != nil {
+		return "", err
 	}
-	fieldValue := xmlData[startIdx+len(startTag) : endIdx]
-	return fieldValue, nil
+	return editor.Get(normalizeOverridePath(path))
 }
 
 func parseMsgHeader(msgStr string) (*MsgHeader, error) {
@@ -486,6 +673,8 @@ func displayStatistics(ctx context.Context, data *StatisticsData, list *tview.Te
 	data.ConvertFileCount = 0
 	data.Detail7211Count = 0
 	data.Detail7221Count = 0
+	data.InvalidMsgCount = 0
+	data.UnsupportedFileCount = 0
 	for {
 		select {
 		case <-ctx.Done():
@@ -497,6 +686,8 @@ func displayStatistics(ctx context.Context, data *StatisticsData, list *tview.Te
 				fmt.Fprintf(list, "发送7221报文数 [%d]\n", data.SedMsg7221Count)
 				fmt.Fprintf(list, "7211明细数 [%d]\n", data.Detail7211Count)
 				fmt.Fprintf(list, "7221明细数 [%d]\n", data.Detail7221Count)
+				fmt.Fprintf(list, "校验不通过报文数 [%d]\n", data.InvalidMsgCount)
+				fmt.Fprintf(list, "不支持的报文文件数 [%d]\n", data.UnsupportedFileCount)
 
 				fmt.Fprintf(list, "\nCurrent Time is %s\n", time.Now().Format("2006-01-02T15:04:05"))
 				fmt.Fprintf(list, "执行结束...")
@@ -746,6 +937,20 @@ func main() {
 				})
 			}()
 		}).
+		AddButton("预览", func() {
+			// 列出按过滤规则会被处理的文件，不做任何修改
+			filter, err := NewFileFilterFromSetting(setting)
+			if err != nil {
+				statisticsList.SetText(fmt.Sprintf("文件过滤规则错误: %v", err))
+				return
+			}
+			previews, err := PreviewFiles(setting.FilePath, setting.EncKey, filter)
+			if err != nil {
+				statisticsList.SetText(fmt.Sprintf("预览失败: %v", err))
+				return
+			}
+			statisticsList.SetText(FormatFilePreview(previews))
+		}).
 		AddButton("Quit", func() {
 			setting.Save()
 			if testClient != nil {
@@ -774,7 +979,12 @@ func main() {
 			button.SetDisabled(true) // 按钮会置灰并禁用
 
 			// 解密
-			decryptFiles(setting.OriginalFilePath, setting.EncKey, statisticdata)
+			filter, err := NewFileFilterFromSetting(setting)
+			if err != nil {
+				AppLogger.Printf("文件过滤规则错误: %v", err)
+			} else {
+				decryptFiles(setting.OriginalFilePath, setting.EncKey, filter, statisticdata)
+			}
 
 			// 更新按钮状态
 			button.SetLabel(Decrypt)
@@ -796,7 +1006,9 @@ func main() {
 			button.SetDisabled(true) // 按钮会置灰并禁用
 
 			// 转换
-			convertFiles(setting.DecryptedFilePath, setting.OriginalFilePath, setting.PayeeOpBkCode, statisticdata)
+			if err := configureRun(setting); err == nil {
+				convertFiles(setting.DecryptedFilePath, setting.OriginalFilePath, setting, statisticdata)
+			}
 
 			// 更新按钮状态
 			button.SetLabel(Convert)
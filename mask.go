@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// 脱敏策略
+const (
+	MaskHash    = "hash"    // 带密钥的哈希假名，保持长度，输出大写十六进制
+	MaskAccount = "account" // 保持格式的账号：数字替换为数字，长度和其他字符不变
+	MaskName    = "name"    // 从字典中替换为中文姓名
+)
+
+// MaskNameDict 姓名替换字典
+type MaskNameDict struct {
+	Surnames []string `json:"surnames"`
+	Given    []string `json:"given"`
+}
+
+// defaultMaskNameDict 默认的姓名字典
+func defaultMaskNameDict() MaskNameDict {
+	return MaskNameDict{
+		Surnames: strings.Split("赵钱孙李周吴郑王冯陈褚卫蒋沈韩杨朱秦尤许何吕施张孔曹严华金魏陶姜", ""),
+		Given:    strings.Split("伟芳娜敏静丽强磊军洋勇艳杰娟涛明超秀霞平刚桂英华玉兰建国志红林海波宁", ""),
+	}
+}
+
+// defaultMaskRules 默认的脱敏字段：元素名 -> 策略
+func defaultMaskRules() map[string]string {
+	return map[string]string{
+		// 7221
+		"PayeeName":    MaskName,
+		"PayeeAcct":    MaskAccount,
+		"TaxPayName":   MaskName,
+		"PayeeOrgCode": MaskHash,
+		// 7211
+		"TaxPayCode":  MaskHash,
+		"HandOrgName": MaskName,
+		"PayAcct":     MaskAccount,
+	}
+}
+
+// Masker 按字段策略对转换后的报文脱敏
+// 同一密钥下相同的输入总是得到相同的输出，一次运行内各报文的脱敏结果保持一致
+type Masker struct {
+	key   []byte
+	rules map[string]string
+	dict  MaskNameDict
+
+	lock  sync.Mutex
+	cache map[string]string
+}
+
+// dataMasker 当前运行的脱敏器，为nil时不脱敏
+var dataMasker *Masker
+
+// NewMasker 创建脱敏器，rulesFile中的字段策略覆盖默认策略，策略为空表示不脱敏该字段
+func NewMasker(key []byte, rulesFile, dictFile string) (*Masker, error) {
+	m := &Masker{
+		key:   key,
+		rules: defaultMaskRules(),
+		dict:  defaultMaskNameDict(),
+		cache: map[string]string{},
+	}
+
+	if rulesFile != "" {
+		content, err := os.ReadFile(rulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取脱敏规则文件失败: %v", err)
+		}
+		overrides := map[string]string{}
+		if err := json.Unmarshal(content, &overrides); err != nil {
+			return nil, fmt.Errorf("解析脱敏规则文件失败: %v", err)
+		}
+		for field, strategy := range overrides {
+			switch strategy {
+			case "":
+				delete(m.rules, field)
+			case MaskHash, MaskAccount, MaskName:
+				m.rules[field] = strategy
+			default:
+				return nil, fmt.Errorf("脱敏规则文件错误: 字段 %s 的策略 %s 不支持", field, strategy)
+			}
+		}
+	}
+
+	if dictFile != "" {
+		content, err := os.ReadFile(dictFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取姓名字典失败: %v", err)
+		}
+		var dict MaskNameDict
+		if err := json.Unmarshal(content, &dict); err != nil {
+			return nil, fmt.Errorf("解析姓名字典失败: %v", err)
+		}
+		if len(dict.Surnames) == 0 || len(dict.Given) == 0 {
+			return nil, fmt.Errorf("姓名字典的surnames和given不能为空")
+		}
+		m.dict = dict
+	}
+	return m, nil
+}
+
+// ConfigureMasking 按配置设置本次运行的脱敏器，每次转换运行开始时调用一次
+// 未配置密钥时：确定性模式由IdSeed派生，否则每次运行随机生成（仅保证运行内一致）
+func ConfigureMasking(setting *Setting) error {
+	if !setting.MaskEnabled {
+		dataMasker = nil
+		return nil
+	}
+
+	key := []byte(setting.MaskKey)
+	if len(key) == 0 {
+		if setting.Deterministic {
+			key = []byte(fmt.Sprintf("mask-seed-%d", setting.IdSeed))
+		} else {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return fmt.Errorf("生成脱敏密钥失败: %v", err)
+			}
+		}
+	}
+	masker, err := NewMasker(key, setting.MaskRulesFile, setting.MaskNameDict)
+	if err != nil {
+		return err
+	}
+	dataMasker = masker
+
+	fields := make([]string, 0, len(masker.rules))
+	for field := range masker.rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	AppLogger.Printf("数据脱敏已开启，脱敏字段: %v", fields)
+	return nil
+}
+
+// MaskCFX 对报文中所有配置了策略的字段脱敏，m为nil时不处理
+func (m *Masker) MaskCFX(cfx *CFX) {
+	if m == nil || cfx == nil {
+		return
+	}
+	m.maskValue(reflect.ValueOf(&cfx.MSG).Elem())
+}
+
+// MaskDocument 对XML文档中所有配置了策略的元素脱敏，包括报文结构中未建模的元素，m为nil时不处理
+func (m *Masker) MaskDocument(editor *XMLEditor) error {
+	if m == nil {
+		return nil
+	}
+	fields := make([]string, 0, len(m.rules))
+	for field := range m.rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		strategy := m.rules[field]
+		_, err := editor.Update("//"+field, func(value string) string {
+			if value == "" {
+				return value
+			}
+			return m.Mask(strategy, value)
+		})
+		if err != nil {
+			return fmt.Errorf("脱敏字段%s失败: %v", field, err)
+		}
+	}
+	return nil
+}
+
+// MaskedCopy 返回脱敏后的报文副本，原报文不变；m为nil时直接返回原报文
+func (m *Masker) MaskedCopy(cfx *CFX) (*CFX, error) {
+	if m == nil || cfx == nil {
+		return cfx, nil
+	}
+	masked, err := cloneCFX(cfx)
+	if err != nil {
+		return nil, err
+	}
+	m.MaskCFX(masked)
+	return masked, nil
+}
+
+// cloneCFX 深拷贝报文结构
+func cloneCFX(cfx *CFX) (*CFX, error) {
+	content, err := xml.Marshal(cfx)
+	if err != nil {
+		return nil, err
+	}
+	var clone CFX
+	if err := unmarshalXMLString(string(content), &clone); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// maskValue 递归遍历结构体，按元素名匹配字段策略
+func (m *Masker) maskValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			m.maskValue(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			m.maskValue(v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := v.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			if field.Kind() == reflect.String {
+				if strategy, ok := m.rules[xmlElementName(t.Field(i))]; ok && field.String() != "" {
+					field.SetString(m.Mask(strategy, field.String()))
+				}
+				continue
+			}
+			m.maskValue(field)
+		}
+	}
+}
+
+// Mask 按策略对单个值脱敏
+func (m *Masker) Mask(strategy, value string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	cacheKey := strategy + "\x00" + value
+	if masked, ok := m.cache[cacheKey]; ok {
+		return masked
+	}
+
+	var masked string
+	switch strategy {
+	case MaskHash:
+		masked = m.maskHash(value)
+	case MaskAccount:
+		masked = m.maskAccount(value)
+	case MaskName:
+		masked = m.maskName(value)
+	default:
+		masked = value
+	}
+	m.cache[cacheKey] = masked
+	return masked
+}
+
+// digest 计算带密钥的哈希，counter用于扩展输出长度
+func (m *Masker) digest(value string, counter int) []byte {
+	mac := hmac.New(sha256.New, m.key)
+	fmt.Fprintf(mac, "%d:%s", counter, value)
+	return mac.Sum(nil)
+}
+
+// stream 生成n个由密钥和原值决定的字节
+func (m *Masker) stream(value string, n int) []byte {
+	var out []byte
+	for counter := 0; len(out) < n; counter++ {
+		out = append(out, m.digest(value, counter)...)
+	}
+	return out[:n]
+}
+
+func (m *Masker) maskHash(value string) string {
+	length := len([]rune(value))
+	const hexDigits = "0123456789ABCDEF"
+	b := m.stream(value, length)
+	out := make([]byte, length)
+	for i := range out {
+		out[i] = hexDigits[b[i]%16]
+	}
+	return string(out)
+}
+
+func (m *Masker) maskAccount(value string) string {
+	runes := []rune(value)
+	b := m.stream(value, len(runes))
+	for i, r := range runes {
+		if r >= '0' && r <= '9' {
+			runes[i] = rune('0' + b[i]%10)
+		} else if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			base := 'A'
+			if unicode.IsLower(r) {
+				base = 'a'
+			}
+			runes[i] = base + rune(b[i]%26)
+		}
+	}
+	return string(runes)
+}
+
+func (m *Masker) maskName(value string) string {
+	b := m.digest(value, 0)
+	pick := func(list []string, offset int) string {
+		return list[binary.BigEndian.Uint32(b[offset:offset+4])%uint32(len(list))]
+	}
+	name := pick(m.dict.Surnames, 0) + pick(m.dict.Given, 4)
+	// 两字或三字姓名
+	if b[8]%2 == 1 {
+		name += pick(m.dict.Given, 12)
+	}
+	return name
+}
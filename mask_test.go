@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+)
+
+// new7221MaskTestCFX 构造收款人信息相同的7221报文
+func new7221MaskTestCFX(traNo string) *CFX {
+	cfx := new7221TestCFX(1)
+	info := &cfx.MSG.DrawbackBody7221.DrawbackInfo7221[0]
+	info.TraNo = traNo
+	info.PayeeName = "张三"
+	info.PayeeAcct = "6222-0000-1111"
+	return cfx
+}
+
+func TestMaskSameKeyConsistentAcrossFiles(t *testing.T) {
+	defer ConfigureMasking(&Setting{})
+	defer func(charset string) { outputCharset = charset }(outputCharset)
+
+	files := []string{
+		writeTestCFX(t, "a.xml", new7221MaskTestCFX("T1")),
+		writeTestCFX(t, "b.xml", new7221MaskTestCFX("T2")),
+	}
+	run := func(key string) []DrawbackInfo7221 {
+		setting := &Setting{MaskEnabled: true, MaskKey: key, OutputCharset: CharsetUTF8}
+		if err := ConfigureMasking(setting); err != nil {
+			t.Fatal(err)
+		}
+		if err := ConfigureConversion(setting); err != nil {
+			t.Fatal(err)
+		}
+		var infos []DrawbackInfo7221
+		for _, file := range files {
+			outputs, err := ConvertMsg(file, setting)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfx := parseOutputCFX(t, outputs[0].Body)
+			infos = append(infos, cfx.MSG.DrawbackBody7221.DrawbackInfo7221...)
+		}
+		return infos
+	}
+
+	first := run("k1")
+	if first[0].PayeeName == "张三" || first[0].PayeeAcct == "6222-0000-1111" {
+		t.Fatalf("收款人信息未脱敏: %+v", first[0])
+	}
+	if len(first[0].PayeeAcct) != len("6222-0000-1111") || first[0].PayeeAcct[4] != '-' {
+		t.Errorf("账号脱敏应保持格式: %s", first[0].PayeeAcct)
+	}
+	if first[0].PayeeName != first[1].PayeeName || first[0].PayeeAcct != first[1].PayeeAcct {
+		t.Errorf("同一次运行中不同文件的脱敏结果不一致: %+v / %+v", first[0], first[1])
+	}
+	if first[0].TraNo != "T1" || first[1].TraNo != "T2" {
+		t.Errorf("未配置脱敏的字段不应修改: %s/%s", first[0].TraNo, first[1].TraNo)
+	}
+
+	// 相同密钥的另一次运行得到相同结果，不同密钥得到不同结果
+	second := run("k1")
+	if second[0].PayeeName != first[0].PayeeName || second[0].PayeeAcct != first[0].PayeeAcct {
+		t.Errorf("相同密钥的脱敏结果不一致: %+v / %+v", first[0], second[0])
+	}
+	if other := run("k2"); other[0].PayeeAcct == first[0].PayeeAcct {
+		t.Errorf("不同密钥的脱敏结果不应相同: %s", other[0].PayeeAcct)
+	}
+}
+
+func TestMaskRulesFile(t *testing.T) {
+	rules := writeTestFile(t, "rules.json", `{"PayeeName": "", "TraNo": "hash"}`)
+	masker, err := NewMasker([]byte("k"), rules, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfx := new7221MaskTestCFX("T1")
+	masker.MaskCFX(cfx)
+	info := cfx.MSG.DrawbackBody7221.DrawbackInfo7221[0]
+	if info.PayeeName != "张三" {
+		t.Errorf("策略为空的字段不应脱敏: %s", info.PayeeName)
+	}
+	if info.TraNo == "T1" || len(info.TraNo) != 2 {
+		t.Errorf("TraNo应按hash策略脱敏并保持长度: %s", info.TraNo)
+	}
+
+	if _, err := NewMasker([]byte("k"), writeTestFile(t, "bad.json", `{"PayeeName": "xx"}`), ""); err == nil {
+		t.Error("未知的脱敏策略应报错")
+	}
+}
@@ -46,7 +46,7 @@ type CTBS990Msg struct {
 }
 
 func (msg *CTBS900Msg) Build900Msg() string {
-	t, _ := template.New("c900").Parse(template900)
+	t, _ := template.New("c900").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(template900)
 
 	var tpl bytes.Buffer
 	t.Execute(&tpl, msg)
@@ -57,23 +57,23 @@ func (msg *CTBS900Msg) Build900Msg() string {
 var template900 = `<?xml version="1.0" encoding="UTF-8"?>
 <MSG>
 	<GrpHdr>
-		<MsgId> {{- .MsgId -}}</MsgId>
-		<CreDtTm> {{- .CreDtTm -}} </CreDtTm>
-		<InstgPty> {{- .InstgPty -}} </InstgPty>
-		<InstdPty> {{- .InstdPty -}} </InstdPty>
+		<MsgId> {{- xml .MsgId -}}</MsgId>
+		<CreDtTm> {{- xml .CreDtTm -}} </CreDtTm>
+		<InstgPty> {{- xml .InstgPty -}} </InstgPty>
+		<InstdPty> {{- xml .InstdPty -}} </InstdPty>
 	</GrpHdr>
 	<OrgnlGrpHdr>
-		<OrgnlMsgId> {{- .OrgnlMsgId -}} </OrgnlMsgId>
-		<OrgnlInstgPty> {{- .OrgnlInstgPty -}} </OrgnlInstgPty>
+		<OrgnlMsgId> {{- xml .OrgnlMsgId -}} </OrgnlMsgId>
+		<OrgnlInstgPty> {{- xml .OrgnlInstgPty -}} </OrgnlInstgPty>
 	</OrgnlGrpHdr>
 	<CmonConfInf>
-		<OrgnlMT> {{- .OrgnlMT -}} </OrgnlMT>
-		<PrcSts> {{- .PrcSts -}} </PrcSts>
+		<OrgnlMT> {{- xml .OrgnlMT -}} </OrgnlMT>
+		<PrcSts> {{- xml .PrcSts -}} </PrcSts>
 	</CmonConfInf>
 </MSG>`
 
 func (msg *CTBS990Msg) Build990Msg() string {
-	t, _ := template.New("c990").Parse(template990)
+	t, _ := template.New("c990").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(template990)
 
 	var tpl bytes.Buffer
 	t.Execute(&tpl, msg)
@@ -84,12 +84,12 @@ func (msg *CTBS990Msg) Build990Msg() string {
 var template990 = `<?xml version="1.0" encoding="UTF-8"?>
 <MSG>
 	<GrpHdr>
-		<MsgId> {{- .MsgId -}} </MsgId>
-		<OrgnlSndr> {{- .OrgnlSndr -}} </OrgnlSndr>
-		<OrgnlSndDt> {{- .OrgnlSndDt -}} </OrgnlSndDt>
-		<OrgnlMsgId> {{- .OrgnlMsgId -}} </OrgnlMsgId>
-		<OrgnlMT> {{- .OrgnlMT -}} </OrgnlMT>
-		<RtnCd> {{- .RtnCd -}} </RtnCd>
+		<MsgId> {{- xml .MsgId -}} </MsgId>
+		<OrgnlSndr> {{- xml .OrgnlSndr -}} </OrgnlSndr>
+		<OrgnlSndDt> {{- xml .OrgnlSndDt -}} </OrgnlSndDt>
+		<OrgnlMsgId> {{- xml .OrgnlMsgId -}} </OrgnlMsgId>
+		<OrgnlMT> {{- xml .OrgnlMT -}} </OrgnlMT>
+		<RtnCd> {{- xml .RtnCd -}} </RtnCd>
 	</GrpHdr>
 </MSG>`
 
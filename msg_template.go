@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateLookupFile 模板目录中的查找表文件：表名 -> (键 -> 值)
+const TemplateLookupFile = "lookup.json"
+
+// TemplateData 输出报文模板的数据
+// 内嵌转换后的报文结构，模板中可直接使用 .HEAD/.MSG；Source 为源报文
+type TemplateData struct {
+	*CFX
+	Source *CFX
+}
+
+// MsgTemplates 按输出报文编号加载的模板
+type MsgTemplates struct {
+	dir       string
+	templates map[string]*template.Template
+	lookups   map[string]map[string]string
+}
+
+// msgTemplates 当前运行的用户模板，由ConfigureTemplates设置，为nil时使用内置转换结果
+var msgTemplates *MsgTemplates
+
+// ConfigureTemplates 按配置加载模板目录，每次转换运行开始时调用一次
+func ConfigureTemplates(setting *Setting) error {
+	templates, err := LoadMsgTemplates(setting.TemplateDir)
+	if err != nil {
+		return err
+	}
+	msgTemplates = templates
+	return nil
+}
+
+// LoadMsgTemplates 加载模板目录中的 <MsgNo>.tmpl 模板文件，dir为空时返回nil（使用内置转换结果）
+func LoadMsgTemplates(dir string) (*MsgTemplates, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	t := &MsgTemplates{
+		dir:       dir,
+		templates: map[string]*template.Template{},
+		lookups:   map[string]map[string]string{},
+	}
+
+	lookupPath := filepath.Join(dir, TemplateLookupFile)
+	if content, err := os.ReadFile(lookupPath); err == nil {
+		if err := json.Unmarshal(content, &t.lookups); err != nil {
+			return nil, fmt.Errorf("解析模板查找表失败 %s: %v", lookupPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取模板查找表失败 %s: %v", lookupPath, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		msgNo := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取模板文件失败 %s: %v", file, err)
+		}
+		tpl, err := template.New(msgNo).Option("missingkey=error").Funcs(t.funcMap()).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("解析模板文件失败 %s: %v", file, err)
+		}
+		t.templates[msgNo] = tpl
+	}
+	return t, nil
+}
+
+// Has 判断是否存在该报文编号的模板
+func (t *MsgTemplates) Has(msgNo string) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.templates[msgNo]
+	return ok
+}
+
+// Render 使用模板生成输出报文的XML字符串（UTF-8）
+func (t *MsgTemplates) Render(msgNo string, data TemplateData) (string, error) {
+	tpl, ok := t.templates[msgNo]
+	if !ok {
+		return "", fmt.Errorf("报文类型[%s]没有模板", msgNo)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("模板[%s]生成报文失败: %v", msgNo, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// funcMap 模板中可用的辅助函数
+func (t *MsgTemplates) funcMap() template.FuncMap {
+	return template.FuncMap{
+		// ID生成
+		"tipsId":   GenerateUniqueTipsId,
+		"uniqueId": GenerateUniqueId,
+		"packNo":   GeneratePackNo,
+		"traNo":    GenerateTraNo,
+		"taxVouNo": GenerateTaxVouNo,
+		// 日期
+		"today":             BusinessDate,
+		"now":               func(layout string) string { return BusinessNow().Format(layout) },
+		"shiftDate":         func(date string) string { return dateShifter.Shift(date) },
+		"shiftBusinessDate": func(date string) string { return dateShifter.ShiftBusinessDate(date) },
+		"addDays": func(date string, days int) (string, error) {
+			d, err := time.Parse("20060102", date)
+			if err != nil {
+				return "", err
+			}
+			return d.AddDate(0, 0, days).Format("20060102"), nil
+		},
+		// 金额
+		"amt": func(s string) (string, error) {
+			a, err := ParseAmount(s)
+			if err != nil {
+				return "", err
+			}
+			return a.String(), nil
+		},
+		"sumAmt": func(amounts ...string) (string, error) {
+			total, err := SumAmounts(amounts)
+			if err != nil {
+				return "", err
+			}
+			return total.String(), nil
+		},
+		// 查找表，lookup.json中没有时再查参考数据
+		"lookup": func(table, key string) string {
+			if value, ok := t.lookups[table][key]; ok {
+				return value
+			}
+			value, _ := referenceData.Lookup(table, key)
+			return value
+		},
+		// 其他
+		"xml": xmlEscape,
+		"add": func(a, b int) int { return a + b },
+	}
+}
+
+// xmlEscape 转义XML特殊字符，text/template不会自动转义，模板中的文本值需要用 {{xml .X}} 输出
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// applyTemplate 使用模板重新生成输出报文，并将生成结果解析回报文结构供后续校验
+func (t *MsgTemplates) applyTemplate(data *OutputData, source *CFX) error {
+	if data.Cfx == nil || !t.Has(data.Cfx.HEAD.MsgNo) {
+		return nil
+	}
+	msgNo := data.Cfx.HEAD.MsgNo
+	content, err := t.Render(msgNo, TemplateData{CFX: data.Cfx, Source: source})
+	if err != nil {
+		return err
+	}
+
+	var rendered CFX
+	if err := unmarshalXMLString(content, &rendered); err != nil {
+		return fmt.Errorf("模板[%s]生成的报文不是合法的XML: %v", msgNo, err)
+	}
+	if err := checkBatchTotals(&rendered, false); err != nil {
+		return fmt.Errorf("模板[%s]生成的报文: %v", msgNo, err)
+	}
+	if !strings.HasPrefix(content, "<?xml") {
+		content = `<?xml version="1.0" encoding="UTF-8"?>` + content
+	}
+	encoded, err := EncodeXMLString(content, charsetOrDefault(outputCharset, DefaultCharset))
+	if err != nil {
+		return err
+	}
+	data.Cfx = &rendered
+	data.Body = encoded
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// template7221Test 按转换结果生成7221报文，AllAmt取自配置的查找表
+const template7221Test = `<?xml version="1.0" encoding="UTF-8"?>
+<CFX><HEAD><VER>{{.HEAD.VER}}</VER><SRC>{{.HEAD.SRC}}</SRC><DES>{{.HEAD.DES}}</DES><APP>{{.HEAD.APP}}</APP><MsgNo>7221</MsgNo><MsgID>{{.HEAD.MsgID}}</MsgID><MsgRef>{{.HEAD.MsgRef}}</MsgRef><WorkDate>{{.HEAD.WorkDate}}</WorkDate></HEAD>
+<MSG><BatchHead7221><TaxOrgCode>{{lookup "org" .MSG.BatchHead7221.TaxOrgCode}}</TaxOrgCode><AllNum>{{.MSG.BatchHead7221.AllNum}}</AllNum><AllAmt>{{lookup "amt" .Source.MSG.BatchHead7221.TaxOrgCode}}</AllAmt></BatchHead7221>
+<DrawbackBody7221>{{range .MSG.DrawbackBody7221.DrawbackInfo7221}}<DrawbackInfo7221><TraNo>{{.TraNo}}</TraNo><Amt>{{amt .Amt}}</Amt><PayeeName>{{xml .PayeeName}}</PayeeName></DrawbackInfo7221>{{end}}</DrawbackBody7221></MSG></CFX>`
+
+// newTestTemplates 在临时目录中写入模板和查找表
+func newTestTemplates(t *testing.T, lookup string) *MsgTemplates {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "7221.tmpl"), []byte(template7221Test), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, TemplateLookupFile), []byte(lookup), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadMsgTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestMsgTemplatesApply(t *testing.T) {
+	defer func(charset string) { outputCharset = charset }(outputCharset)
+	outputCharset = CharsetUTF8
+
+	source := new7221TestCFX(2)
+	source.MSG.DrawbackBody7221.DrawbackInfo7221[0].PayeeName = `A&B <公司>`
+	outputs, err := Convert7221(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := outputs[0]
+
+	templates := newTestTemplates(t, `{"org": {"A01": "B02"}, "amt": {"A01": "3.30"}}`)
+	if err := templates.applyTemplate(output, source); err != nil {
+		t.Fatal(err)
+	}
+	if got := output.Cfx.MSG.BatchHead7221.TaxOrgCode; got != "B02" {
+		t.Errorf("TaxOrgCode = %s, want B02", got)
+	}
+	if got := output.Cfx.MSG.DrawbackBody7221.DrawbackInfo7221[0].PayeeName; got != `A&B <公司>` {
+		t.Errorf("PayeeName = %q", got)
+	}
+	if !strings.Contains(output.Body, "A&amp;B &lt;公司&gt;") {
+		t.Errorf("PayeeName未转义: %s", output.Body)
+	}
+
+	// 模板生成的总金额与明细不一致
+	templates = newTestTemplates(t, `{"org": {"A01": "B02"}, "amt": {"A01": "9.99"}}`)
+	outputs, _ = Convert7221(new7221TestCFX(2))
+	if err := templates.applyTemplate(outputs[0], source); err == nil || !strings.Contains(err.Error(), "AllAmt") {
+		t.Errorf("总金额不一致应报错: %v", err)
+	}
+
+	// 没有模板的报文类型保持内置转换结果
+	var nilTemplates *MsgTemplates
+	body := outputs[0].Body
+	if err := nilTemplates.applyTemplate(outputs[0], source); err != nil || outputs[0].Body != body {
+		t.Errorf("没有模板时不应修改报文: %v", err)
+	}
+}
+
+func TestLoadMsgTemplatesErrors(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "7221.tmpl"), []byte(`{{.HEAD.VER`), 0644)
+	if _, err := LoadMsgTemplates(dir); err == nil {
+		t.Error("模板语法错误应报错")
+	}
+	dir = t.TempDir()
+	os.WriteFile(filepath.Join(dir, TemplateLookupFile), []byte(`{"org": `), 0644)
+	if _, err := LoadMsgTemplates(dir); err == nil {
+		t.Error("查找表格式错误应报错")
+	}
+}
+
+func TestBuild900MsgEscapes(t *testing.T) {
+	msg := &CTBS900Msg{MsgId: "1", OrgnlMsgId: "a<b&c"}
+	if got := msg.Build900Msg(); !strings.Contains(got, "<OrgnlMsgId>a&lt;b&amp;c</OrgnlMsgId>") {
+		t.Errorf("Build900Msg = %s", got)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 覆盖规则值的前缀
+const (
+	overrideGenPrefix     = "gen:"     // 调用生成器，每个匹配的元素单独生成
+	overrideSettingPrefix = "setting:" // 取配置项的值，按settings.json中的键名
+)
+
+// overrideSettingKeys 覆盖规则中允许用 setting: 引用的配置项，只开放报文相关的非敏感配置，
+// 避免密码、密钥等被写进报文
+var overrideSettingKeys = map[string]bool{
+	"payee_op_bk_code":     true,
+	"sed_queue_tips":       true,
+	"sed_queue_ctbs":       true,
+	"mq_queue_manager":     true,
+	"mq_source_queue":      true,
+	"mq_destination":       true,
+	"target_business_date": true,
+}
+
+var (
+	overrideRulePattern = regexp.MustCompile(`^(?:when\s+(.+?)\s+)?set\s+(\S+)\s*=\s*(.+)$`)
+	overrideCondPattern = regexp.MustCompile(`^(\S+?)\s*(!=|=)\s*(.+)$`)
+	overrideAndPattern  = regexp.MustCompile(`\s+and\s+`)
+)
+
+// OverrideCondition 规则的生效条件，路径的任一值满足即成立
+type OverrideCondition struct {
+	Path  string
+	Op    string // = 或 !=
+	Value string
+}
+
+// OverrideRule 字段覆盖规则
+//
+//	when MsgNo=7221 set HEAD/DES = "333333333333"
+//	set //PackNo = gen:packno
+//	set //PayeeOpBkCode = setting:payee_op_bk_code
+//
+// 路径与XMLEditor相同：从报文根元素下开始（如HEAD/DES、MSG/BatchHead7221/PackNo），
+// 支持 //Name、[n] 和 @attr；不含/的路径等同于 //Name
+type OverrideRule struct {
+	Line       int
+	Conditions []OverrideCondition
+	Path       string
+	Value      string
+}
+
+// OverrideRules 按文件顺序执行的覆盖规则
+type OverrideRules []OverrideRule
+
+// overrideRules 当前运行的字段覆盖规则，由ConfigureOverrides设置
+var overrideRules OverrideRules
+
+// ConfigureOverrides 按配置加载字段覆盖规则，每次转换运行开始时调用一次
+func ConfigureOverrides(setting *Setting) error {
+	rules, err := LoadOverrideRules(setting.OverrideRulesFile)
+	if err != nil {
+		return err
+	}
+	overrideRules = rules
+	return nil
+}
+
+// LoadOverrideRules 加载字段覆盖规则文件，每行一条规则，#开头为注释；path为空时返回nil
+func LoadOverrideRules(path string) (OverrideRules, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取字段覆盖规则文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var rules OverrideRules
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseOverrideRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("字段覆盖规则文件第%d行错误: %v", lineNo, err)
+		}
+		rule.Line = lineNo
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取字段覆盖规则文件失败: %v", err)
+	}
+	return rules, nil
+}
+
+// parseOverrideRule 解析单条规则
+func parseOverrideRule(line string) (OverrideRule, error) {
+	m := overrideRulePattern.FindStringSubmatch(line)
+	if m == nil {
+		return OverrideRule{}, fmt.Errorf("格式应为 [when 路径=值 [and ...]] set 路径 = 值")
+	}
+	rule := OverrideRule{Path: normalizeOverridePath(m[2])}
+	if _, _, _, _, err := parseXMLEditPath(rule.Path); err != nil {
+		return OverrideRule{}, err
+	}
+	value, err := parseOverrideValue(m[3])
+	if err != nil {
+		return OverrideRule{}, err
+	}
+	if err := validateOverrideValue(value); err != nil {
+		return OverrideRule{}, err
+	}
+	rule.Value = value
+
+	if m[1] != "" {
+		for _, cond := range overrideAndPattern.Split(m[1], -1) {
+			c := overrideCondPattern.FindStringSubmatch(strings.TrimSpace(cond))
+			if c == nil {
+				return OverrideRule{}, fmt.Errorf("条件 %s 格式应为 路径=值 或 路径!=值", cond)
+			}
+			condValue, err := parseOverrideValue(c[3])
+			if err != nil {
+				return OverrideRule{}, err
+			}
+			condPath := normalizeOverridePath(c[1])
+			if _, _, _, _, err := parseXMLEditPath(condPath); err != nil {
+				return OverrideRule{}, err
+			}
+			rule.Conditions = append(rule.Conditions, OverrideCondition{Path: condPath, Op: c[2], Value: condValue})
+		}
+	}
+	return rule, nil
+}
+
+// parseOverrideValue 解析值，双引号括起的值按Go字符串转义处理
+func parseOverrideValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("值 %s 的引号不匹配", value)
+		}
+		return unquoted, nil
+	}
+	return value, nil
+}
+
+// validateOverrideValue 校验生成器、配置项是否存在，配置项只能引用 overrideSettingKeys 中的非敏感配置
+func validateOverrideValue(value string) error {
+	switch {
+	case strings.HasPrefix(value, overrideGenPrefix):
+		name := strings.ToLower(strings.TrimPrefix(value, overrideGenPrefix))
+		if _, ok := mappingGenerators[name]; !ok {
+			return fmt.Errorf("生成器 %s 不存在", name)
+		}
+	case strings.HasPrefix(value, overrideSettingPrefix):
+		key := strings.TrimPrefix(value, overrideSettingPrefix)
+		if _, ok := settingFieldByKey(&Setting{}, key); !ok {
+			return fmt.Errorf("配置项 %s 不存在", key)
+		}
+		if !overrideSettingKeys[key] {
+			return fmt.Errorf("配置项 %s 不允许在覆盖规则中引用", key)
+		}
+	}
+	return nil
+}
+
+// normalizeOverridePath 不含/的路径等同于 //Name
+func normalizeOverridePath(path string) string {
+	if !strings.Contains(path, "/") {
+		return "//" + path
+	}
+	return path
+}
+
+// settingFieldByKey 按settings.json中的键名查找配置项
+func settingFieldByKey(setting *Setting, key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(setting).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == key && name != "-" {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// Apply 按顺序对输出报文执行覆盖规则，返回修改的元素个数
+// 规则直接编辑报文体，未修改的部分保持不变；有修改时重新校验总笔数和总金额并同步更新报文结构
+func (rules OverrideRules) Apply(data *OutputData, setting *Setting) (int, error) {
+	if len(rules) == 0 || data.Cfx == nil {
+		return 0, nil
+	}
+	content, charset, err := DecodeXMLBytes([]byte(data.Body))
+	if err != nil {
+		return 0, err
+	}
+	editor, err := NewXMLEditor(content)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, rule := range rules {
+		// 条件按当前文档判断，后面的规则能看到前面规则的修改
+		ok, err := rule.matches(editor)
+		if err != nil {
+			return changed, fmt.Errorf("字段覆盖规则第%d行条件错误: %v", rule.Line, err)
+		}
+		if !ok {
+			continue
+		}
+		n, err := editor.SetFunc(rule.Path, func() string { return rule.resolve(setting) })
+		if err != nil {
+			return changed, fmt.Errorf("字段覆盖规则第%d行设置%s失败: %v", rule.Line, rule.Path, err)
+		}
+		changed += n
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+
+	var cfx CFX
+	if err := unmarshalXMLString(editor.String(), &cfx); err != nil {
+		return changed, fmt.Errorf("按字段覆盖规则修改后的报文解析失败: %v", err)
+	}
+	if err := checkBatchTotals(&cfx, recomputeTotals); err != nil {
+		return changed, fmt.Errorf("字段覆盖后的报文: %v", err)
+	}
+	if recomputeTotals {
+		if err := writeBatchTotals(editor, &cfx); err != nil {
+			return changed, err
+		}
+	}
+	body, err := EncodeXMLString(editor.String(), charset)
+	if err != nil {
+		return changed, err
+	}
+	data.Cfx = &cfx
+	data.Body = body
+	return changed, nil
+}
+
+// writeBatchTotals 将批量头的AllNum/AllAmt写回报文体，用于按明细重算总笔数和总金额之后
+func writeBatchTotals(editor *XMLEditor, cfx *CFX) error {
+	var head, allNum, allAmt string
+	switch {
+	case cfx.MSG.BatchHead7221 != nil:
+		head, allNum, allAmt = "MSG/BatchHead7221", cfx.MSG.BatchHead7221.AllNum, cfx.MSG.BatchHead7221.AllAmt
+	case cfx.MSG.BatchHead7211 != nil:
+		head, allNum, allAmt = "MSG/BatchHead7211", strconv.Itoa(cfx.MSG.BatchHead7211.AllNum), cfx.MSG.BatchHead7211.AllAmt
+	default:
+		return nil
+	}
+	if _, err := editor.Set(head+"/AllNum", allNum); err != nil {
+		return err
+	}
+	_, err := editor.Set(head+"/AllAmt", allAmt)
+	return err
+}
+
+// matches 判断全部条件是否成立
+func (rule OverrideRule) matches(editor *XMLEditor) (bool, error) {
+	for _, cond := range rule.Conditions {
+		values, err := editor.GetAll(cond.Path)
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for _, value := range values {
+			if value == cond.Value {
+				found = true
+			}
+		}
+		if found != (cond.Op == "=") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// resolve 计算规则的值
+func (rule OverrideRule) resolve(setting *Setting) string {
+	switch {
+	case strings.HasPrefix(rule.Value, overrideGenPrefix):
+		return mappingGenerators[strings.ToLower(strings.TrimPrefix(rule.Value, overrideGenPrefix))]()
+	case strings.HasPrefix(rule.Value, overrideSettingPrefix):
+		key := strings.TrimPrefix(rule.Value, overrideSettingPrefix)
+		field, ok := settingFieldByKey(setting, key)
+		if !ok || !overrideSettingKeys[key] {
+			return ""
+		}
+		return fmt.Sprint(field.Interface())
+	default:
+		return rule.Value
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const overrideTestDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<CFX><HEAD><DES>111111111111</DES><MsgNo>7221</MsgNo></HEAD><MSG>
+<BatchHead7221><PackNo>P1</PackNo><AllNum>2</AllNum><AllAmt>3.00</AllAmt></BatchHead7221>
+<DrawbackBody7221><DrawbackInfo7221 flag="a"><TraNo>01</TraNo><Amt>1.00</Amt><PayeeOpBkCode>B1</PayeeOpBkCode></DrawbackInfo7221><DrawbackInfo7221><TraNo>02</TraNo><Amt>2.00</Amt><PayeeOpBkCode>B2</PayeeOpBkCode></DrawbackInfo7221></DrawbackBody7221>
+</MSG></CFX>`
+
+func TestLoadOverrideRules(t *testing.T) {
+	path := writeTestFile(t, "rules.txt", `# 注释
+when MsgNo=7221 and TaxOrgCode!=X set HEAD/DES = "333333333333"
+set PackNo = gen:packno
+set //PayeeOpBkCode = setting:payee_op_bk_code
+`)
+	rules, err := LoadOverrideRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("%d条规则, want 3", len(rules))
+	}
+	first := rules[0]
+	if first.Line != 2 || first.Path != "HEAD/DES" || first.Value != "333333333333" || len(first.Conditions) != 2 {
+		t.Errorf("第1条规则 = %+v", first)
+	}
+	if cond := first.Conditions[1]; cond.Path != "//TaxOrgCode" || cond.Op != "!=" || cond.Value != "X" {
+		t.Errorf("条件 = %+v", cond)
+	}
+	if rules[1].Path != "//PackNo" {
+		t.Errorf("不含/的路径应等同于//Name: %s", rules[1].Path)
+	}
+}
+
+func TestLoadOverrideRulesErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"HEAD/DES = 1", "格式"},
+		{`set HEAD/DES = "1`, "引号"},
+		{"set PackNo = gen:nosuch", "生成器"},
+		{"set PackNo = setting:nosuch", "不存在"},
+		{"set PayeeName = setting:password", "不允许"},
+		{"set PayeeName = setting:enc_key", "不允许"},
+		{"set PayeeName = setting:mask_key", "不允许"},
+		{"when MsgNo set DES = 1", "条件"},
+	}
+	for _, tt := range tests {
+		_, err := LoadOverrideRules(writeTestFile(t, "rules.txt", tt.rule))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("规则 %q: err = %v, want 包含 %s", tt.rule, err, tt.want)
+		}
+	}
+}
+
+func TestOverrideRulesApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		changed int
+		want    []string // 修改后报文中应包含的片段
+	}{
+		{"不含/的路径匹配任意层级", []string{`set PayeeOpBkCode = "X"`}, 2,
+			[]string{"<PayeeOpBkCode>X</PayeeOpBkCode><", "<Amt>2.00</Amt><PayeeOpBkCode>X</PayeeOpBkCode>"}},
+		{"按序号修改", []string{`set MSG/DrawbackBody7221/DrawbackInfo7221[2]/TraNo = 99`}, 1,
+			[]string{"<TraNo>01</TraNo>", "<TraNo>99</TraNo>"}},
+		{"修改属性", []string{`set MSG/DrawbackBody7221/DrawbackInfo7221[1]/@flag = b`}, 1,
+			[]string{`<DrawbackInfo7221 flag="b">`}},
+		{"条件成立", []string{`when MsgNo=7221 and HEAD/DES!=333333333333 set HEAD/DES = 333333333333`}, 1,
+			[]string{"<DES>333333333333</DES>"}},
+		{"条件不成立", []string{`when MsgNo=7211 set HEAD/DES = 333333333333`}, 0,
+			[]string{"<DES>111111111111</DES>"}},
+		{"条件使用属性", []string{`when MSG/DrawbackBody7221/DrawbackInfo7221/@flag=a set //PackNo = P2`}, 1,
+			[]string{"<PackNo>P2</PackNo>"}},
+		{"后面的规则看到前面的修改", []string{`set HEAD/DES = A`, `when HEAD/DES=A set HEAD/MsgNo = 7222`}, 2,
+			[]string{"<DES>A</DES>", "<MsgNo>7222</MsgNo>"}},
+		{"取配置项", []string{`set //PayeeOpBkCode = setting:payee_op_bk_code`}, 2,
+			[]string{"<PayeeOpBkCode>102100099996</PayeeOpBkCode>"}},
+	}
+	setting := &Setting{PayeeOpBkCode: "102100099996"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules OverrideRules
+			for i, line := range tt.rules {
+				rule, err := parseOverrideRule(line)
+				if err != nil {
+					t.Fatalf("parseOverrideRule(%s): %v", line, err)
+				}
+				rule.Line = i + 1
+				rules = append(rules, rule)
+			}
+			data := &OutputData{Body: overrideTestDoc, Cfx: &CFX{}}
+			changed, err := rules.Apply(data, setting)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("Apply 修改了%d个, want %d", changed, tt.changed)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(data.Body, want) {
+					t.Errorf("修改后的报文缺少 %s:\n%s", want, data.Body)
+				}
+			}
+			if changed > 0 && data.Cfx.MSG.BatchHead7221 == nil {
+				t.Errorf("修改后应同步更新报文结构")
+			}
+		})
+	}
+}
+
+func TestParseOverrideRuleErrors(t *testing.T) {
+	for _, line := range []string{
+		`set HEAD/DES`,
+		`set HEAD/DES[x] = 1`,
+		`when HEAD//DES=1 set HEAD/DES = 1`,
+		`set HEAD/DES = gen:none`,
+		`set HEAD/DES = setting:none`,
+		`set HEAD/DES = "abc`,
+	} {
+		if _, err := parseOverrideRule(line); err == nil {
+			t.Errorf("parseOverrideRule(%s) 应返回错误", line)
+		}
+	}
+}
+
+func TestOverrideRuleResolveSensitiveSetting(t *testing.T) {
+	// 未通过文件加载的规则同样不能读取敏感配置
+	rule := OverrideRule{Path: "HEAD/DES", Value: "setting:password"}
+	if got := rule.resolve(&Setting{Password: "secret"}); got != "" {
+		t.Errorf("setting:password = %q, want 空", got)
+	}
+}
+
+func TestConvertMsgOverridesAfterTemplate(t *testing.T) {
+	defer func(templates *MsgTemplates, rules OverrideRules, recompute bool, charset string) {
+		msgTemplates, overrideRules, recomputeTotals, outputCharset = templates, rules, recompute, charset
+	}(msgTemplates, overrideRules, recomputeTotals, outputCharset)
+	outputCharset = CharsetUTF8
+	file := writeTestCFX(t, "7221.xml", new7221TestCFX(2))
+
+	// 模板把TaxOrgCode改为B02，覆盖规则在模板之后执行，能看到并修改模板的结果
+	msgTemplates = newTestTemplates(t, `{"org": {"A01": "B02"}, "amt": {"A01": "3.30"}}`)
+	rules, err := LoadOverrideRules(writeTestFile(t, "rules.txt", `when TaxOrgCode=B02 set HEAD/DES = "444"
+set TaxOrgCode = C03
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrideRules = rules
+	outputs, err := ConvertMsg(file, &Setting{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfx := parseOutputCFX(t, outputs[0].Body)
+	if cfx.HEAD.DES != "444" || cfx.MSG.BatchHead7221.TaxOrgCode != "C03" {
+		t.Errorf("DES/TaxOrgCode = %s/%s, want 444/C03", cfx.HEAD.DES, cfx.MSG.BatchHead7221.TaxOrgCode)
+	}
+
+	// 覆盖金额后重新校验总金额：不允许重算时报错，允许时按明细重算
+	msgTemplates = nil
+	overrideRules, err = LoadOverrideRules(writeTestFile(t, "rules.txt", "set Amt = 1.00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recomputeTotals = false
+	if _, err := ConvertMsg(file, &Setting{}); err == nil || !strings.Contains(err.Error(), "字段覆盖后的报文") {
+		t.Errorf("覆盖金额后总金额不一致应报错, err = %v", err)
+	}
+	recomputeTotals = true
+	outputs, err = ConvertMsg(file, &Setting{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parseOutputCFX(t, outputs[0].Body).MSG.BatchHead7221.AllAmt; got != "2.00" {
+		t.Errorf("AllAmt = %s, want 2.00", got)
+	}
+}
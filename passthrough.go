@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// passThroughSource 透传模式下输出报文对应的源报文
+type passThroughSource struct {
+	doc     string // 源报文原文（已解码为UTF-8）
+	details []int  // 输出报文中的明细在源报文中的序号（从1开始），与输出报文中的明细按顺序一一对应
+}
+
+// sourceDocument 当前转换的源报文原文，由ConvertMsg在转换前设置
+var sourceDocument string
+
+// passThroughField 透传模式下按转换结果改写的字段，Child为相对Parent的路径
+type passThroughField struct {
+	Parent string
+	Child  string
+}
+
+// passThroughDetailPaths 报文编号 -> 明细元素路径
+var passThroughDetailPaths = map[string]string{
+	"7221": "MSG/DrawbackBody7221/DrawbackInfo7221",
+	"7211": "MSG/TaxBody7211/TaxInfo7211",
+}
+
+// passThroughFields 报文编号 -> 按转换结果改写的字段，其余内容保持源报文原文
+// 需要脱敏的字段不在其中，由脱敏规则直接作用于源报文
+var passThroughFields = map[string][]passThroughField{
+	"7221": {
+		{"HEAD", "VER"},
+		{"HEAD", "SRC"},
+		{"HEAD", "DES"},
+		{"HEAD", "APP"},
+		{"HEAD", "MsgID"},
+		{"HEAD", "MsgRef"},
+		{"HEAD", "WorkDate"},
+		{"MSG/BatchHead7221", "EntrustDate"},
+		{"MSG/BatchHead7221", "PackNo"},
+		{"MSG/BatchHead7221", "AllNum"},
+		{"MSG/BatchHead7221", "AllAmt"},
+		{"MSG/DrawbackBody7221/DrawbackInfo7221", "TraNo"},
+		{"MSG/DrawbackBody7221/DrawbackInfo7221", "BillDate"},
+		{"MSG/DrawbackBody7221/DrawbackInfo7221", "Amt"},
+		{"MSG/DrawbackBody7221/DrawbackInfo7221", "PayeeOpBkCode"},
+	},
+	"7211": {
+		{"HEAD", "VER"},
+		{"HEAD", "SRC"},
+		{"HEAD", "DES"},
+		{"HEAD", "APP"},
+		{"HEAD", "MsgID"},
+		{"HEAD", "MsgRef"},
+		{"HEAD", "WorkDate"},
+		{"MSG/BatchHead7211", "EntrustDate"},
+		{"MSG/BatchHead7211", "PackNo"},
+		{"MSG/BatchHead7211", "AllNum"},
+		{"MSG/BatchHead7211", "AllAmt"},
+		{"MSG/TurnAccount7211", "FundSrlNo"},
+		{"MSG/TaxBody7211/TaxInfo7211", "Payment7211/TraNo"},
+		{"MSG/TaxBody7211/TaxInfo7211", "Payment7211/TraAmt"},
+		{"MSG/TaxBody7211/TaxInfo7211", "TaxVou7211/TaxVouNo"},
+		{"MSG/TaxBody7211/TaxInfo7211", "TaxVou7211/BillDate"},
+		{"MSG/TaxBody7211/TaxInfo7211", "TaxType7211/LimitDate"},
+		{"MSG/TaxBody7211/TaxInfo7211", "TaxType7211/TaxStartDate"},
+		{"MSG/TaxBody7211/TaxInfo7211", "TaxType7211/TaxEndDate"},
+		{"MSG/TaxBody7211/TaxInfo7211/TaxType7211/SubjectList7211", "TaxAmt"},
+		{"MSG/TaxBody7211/TaxInfo7211/TaxType7211/SubjectList7211", "ExpTaxAmt"},
+		{"MSG/TaxBody7211/TaxInfo7211/TaxType7211/SubjectList7211", "DiscountTaxAmt"},
+		{"MSG/TaxBody7211/TaxInfo7211/TaxType7211/SubjectList7211", "FactTaxAmt"},
+	},
+}
+
+// newPassThroughSource 记录输出报文对应的源报文明细，从源报文第start+1条明细开始共count条；非透传模式返回nil
+func newPassThroughSource(start, count int) *passThroughSource {
+	if !passThrough {
+		return nil
+	}
+	source := &passThroughSource{doc: sourceDocument}
+	for i := 1; i <= count; i++ {
+		source.details = append(source.details, start+i)
+	}
+	return source
+}
+
+// renderPassThrough 透传模式下在源报文原文上生成输出报文
+// 删除不属于本报文的明细，按脱敏器依次脱敏，再按转换后的报文结构改写ID、日期、金额等字段；
+// 未建模的元素、属性、注释和元素顺序保持不变，生成后重新解析报文结构
+func renderPassThrough(data *OutputData, maskers ...*Masker) error {
+	msgNo := data.Cfx.HEAD.MsgNo
+	editor, err := NewXMLEditor(data.passThrough.doc)
+	if err != nil {
+		return err
+	}
+
+	keep := map[int]bool{}
+	for _, n := range data.passThrough.details {
+		keep[n] = true
+	}
+	if _, err := editor.Retain(passThroughDetailPaths[msgNo], func(n int) bool { return keep[n] }); err != nil {
+		return err
+	}
+
+	for _, masker := range maskers {
+		if err := masker.MaskDocument(editor); err != nil {
+			return err
+		}
+	}
+
+	fields := map[string][]xmlFieldValue{}
+	collectXMLFields(reflect.ValueOf(data.Cfx).Elem(), "", "", fields)
+	for _, field := range passThroughFields[msgNo] {
+		var values []string
+		for _, value := range fields[field.Parent+"/"+field.Child] {
+			values = append(values, value.Value)
+		}
+		if _, err := editor.SetEach(field.Parent, field.Child, values); err != nil {
+			return fmt.Errorf("透传模式改写%s/%s失败: %v", field.Parent, field.Child, err)
+		}
+	}
+
+	content := editor.String()
+	charset := charsetOrDefault(outputCharset, DefaultCharset)
+	if !strings.HasPrefix(strings.TrimSpace(content), "<?xml") {
+		content = `<?xml version="1.0" encoding="` + charset + `"?>` + content
+	}
+	var cfx CFX
+	if err := unmarshalXMLString(content, &cfx); err != nil {
+		return fmt.Errorf("透传模式生成的报文解析失败: %v", err)
+	}
+	body, err := EncodeXMLString(content, charset)
+	if err != nil {
+		return err
+	}
+	data.Cfx = &cfx
+	data.Body = body
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const passThroughTestDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<CFX>
+  <HEAD><VER>1.0</VER><SRC>100000000000</SRC><DES>111111111111</DES><APP>TIPS</APP><MsgNo>7221</MsgNo><MsgID>SRC01</MsgID><MsgRef>SRC01</MsgRef><WorkDate>20250110</WorkDate><Reserve>R1</Reserve></HEAD>
+  <MSG>
+    <!-- 扩展块 -->
+    <ExtBlock><PayeeName>扩展张三</PayeeName></ExtBlock>
+    <BatchHead7221 ver="2"><TaxOrgCode>135</TaxOrgCode><EntrustDate>20250110</EntrustDate><PackNo>P1</PackNo><DrawBackTreCode>135</DrawBackTreCode><ReckStyle>1</ReckStyle><AllNum>3</AllNum><AllAmt>6.30</AllAmt></BatchHead7221>
+    <DrawbackBody7221>
+      <DrawbackInfo7221 seq="1"><TraNo>01</TraNo><BillDate>20250109</BillDate><Amt ccy="CNY">1.10</Amt><PayeeName>张三</PayeeName><PayeeOpBkCode>102</PayeeOpBkCode><InfoExt>e1</InfoExt></DrawbackInfo7221>
+      <DrawbackInfo7221 seq="2"><TraNo>02</TraNo><BillDate>20250110</BillDate><Amt ccy="CNY">2.10</Amt><PayeeName>李四</PayeeName><PayeeOpBkCode>102</PayeeOpBkCode></DrawbackInfo7221>
+      <DrawbackInfo7221 seq="3"><TraNo>03</TraNo><BillDate>20250110</BillDate><Amt ccy="CNY">3.10</Amt><PayeeName>王五</PayeeName><PayeeOpBkCode>102</PayeeOpBkCode></DrawbackInfo7221>
+    </DrawbackBody7221>
+  </MSG>
+</CFX>`
+
+func TestConvert7221PassThrough(t *testing.T) {
+	defer func(pass bool, size int, bkCode, charset string, masker *Masker, shifter *DateShifter) {
+		passThrough, split7221Size, payeeOpBkCode, outputCharset, dataMasker, dateShifter = pass, size, bkCode, charset, masker, shifter
+	}(passThrough, split7221Size, payeeOpBkCode, outputCharset, dataMasker, dateShifter)
+
+	masker, err := NewMasker([]byte("k"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passThrough, split7221Size, payeeOpBkCode, outputCharset, dataMasker = true, 2, "999", CharsetUTF8, masker
+	dateShifter = &DateShifter{target: mustParseDate(t, "20261020"), calendar: &BusinessCalendar{}}
+
+	var cfx CFX
+	if err := unmarshalXMLString(passThroughTestDoc, &cfx); err != nil {
+		t.Fatal(err)
+	}
+	sourceDocument = passThroughTestDoc
+	dateShifter.Begin(&cfx)
+	outputs, err := Convert7221(&cfx)
+	if err != nil {
+		t.Fatalf("Convert7221: %v", err)
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("应拆分为2个报文, got %d", len(outputs))
+	}
+
+	first, second := outputs[0], outputs[1]
+	for _, want := range []string{
+		"<!-- 扩展块 -->\n    <ExtBlock><PayeeName>",
+		`<BatchHead7221 ver="2"><TaxOrgCode>135</TaxOrgCode><EntrustDate>20261020</EntrustDate>`,
+		"<Reserve>R1</Reserve>",
+		"<AllNum>2</AllNum><AllAmt>3.20</AllAmt>",
+		`<DrawbackInfo7221 seq="1"><TraNo>01</TraNo><BillDate>20261019</BillDate><Amt ccy="CNY">1.10</Amt>`,
+		"<PayeeOpBkCode>999</PayeeOpBkCode><InfoExt>e1</InfoExt>",
+		"</DrawbackInfo7221>\n    </DrawbackBody7221>",
+	} {
+		if !strings.Contains(first.Body, want) {
+			t.Errorf("第一个报文缺少 %q:\n%s", want, first.Body)
+		}
+	}
+	for _, leaked := range []string{"张三", "李四", "SRC01", "<PackNo>P1</PackNo>", `seq="3"`} {
+		if strings.Contains(first.Body, leaked) {
+			t.Errorf("第一个报文不应包含 %q:\n%s", leaked, first.Body)
+		}
+	}
+	if !strings.Contains(second.Body, `<DrawbackInfo7221 seq="3">`) || strings.Contains(second.Body, `seq="1"`) {
+		t.Errorf("第二个报文应只包含第3条明细:\n%s", second.Body)
+	}
+
+	// 报文结构与报文体一致，脱敏结果与按报文结构脱敏相同
+	if first.Cfx.HEAD.MsgID == "SRC01" || !strings.Contains(first.Body, "<MsgID>"+first.Cfx.HEAD.MsgID+"</MsgID>") {
+		t.Errorf("报文结构的MsgID %s 与报文体不一致", first.Cfx.HEAD.MsgID)
+	}
+	if got, want := first.Cfx.MSG.DrawbackBody7221.DrawbackInfo7221[0].PayeeName, masker.Mask(MaskName, "张三"); got != want {
+		t.Errorf("PayeeName = %s, want %s", got, want)
+	}
+	if len(first.Cfx.MSG.DrawbackBody7221.DrawbackInfo7221) != 2 {
+		t.Errorf("第一个报文应有2条明细")
+	}
+}
+
+const convert7211TestDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<CFX><HEAD><VER>1.0</VER><SRC>1</SRC><DES>3</DES><APP>TIPS</APP><MsgNo>7211</MsgNo><MsgID>SRC01</MsgID><MsgRef>SRC01</MsgRef><WorkDate>20250110</WorkDate><Reserve>R1</Reserve></HEAD>
+<MSG><BatchHead7211><TaxOrgCode>A01</TaxOrgCode><EntrustDate>20250110</EntrustDate><PackNo>P1</PackNo><AllNum>1</AllNum><AllAmt>2.25</AllAmt></BatchHead7211>
+<TaxBody7211><TaxInfo7211><Payment7211 kind="x"><TraNo>T1</TraNo><TraAmt>2.25</TraAmt></Payment7211>
+<TaxVou7211><TaxVouNo>V1</TaxVouNo><BillDate>20250109</BillDate></TaxVou7211>
+<TaxType7211><LimitDate>20250115</LimitDate><TaxStartDate>20241201</TaxStartDate><TaxEndDate>20241231</TaxEndDate><SubjectList7211><TaxAmt>2.25</TaxAmt></SubjectList7211></TaxType7211>
+<ExtInfo>e1</ExtInfo></TaxInfo7211></TaxBody7211></MSG></CFX>`
+
+func TestConvert7211(t *testing.T) {
+	defer func(pass bool, charset string, masker *Masker, shifter *DateShifter) {
+		passThrough, outputCharset, dataMasker, dateShifter = pass, charset, masker, shifter
+	}(passThrough, outputCharset, dataMasker, dateShifter)
+	outputCharset, dataMasker = CharsetUTF8, nil
+	dateShifter = &DateShifter{target: mustParseDate(t, "20250120"), calendar: &BusinessCalendar{}}
+
+	for _, pass := range []bool{false, true} {
+		passThrough = pass
+		var cfx CFX
+		if err := unmarshalXMLString(convert7211TestDoc, &cfx); err != nil {
+			t.Fatal(err)
+		}
+		sourceDocument = convert7211TestDoc
+		dateShifter.Begin(&cfx)
+		outputs, err := Convert7211(&cfx)
+		if err != nil || len(outputs) != 1 {
+			t.Fatalf("pass=%v Convert7211 = %d, %v", pass, len(outputs), err)
+		}
+		output := outputs[0]
+		taxType := output.Cfx.MSG.TaxBody7211.TaxInfo7211[0].TaxType7211
+		if got := output.Cfx.MSG.TaxBody7211.TaxInfo7211[0].TaxVou7211.BillDate; got != "20250119" {
+			t.Errorf("pass=%v BillDate = %s, want 20250119", pass, got)
+		}
+		if taxType.LimitDate != "20250125" || taxType.TaxStartDate != "20241211" || taxType.TaxEndDate != "20250110" {
+			t.Errorf("pass=%v 限缴日期和所属期 = %s %s %s, want 20250125 20241211 20250110", pass, taxType.LimitDate, taxType.TaxStartDate, taxType.TaxEndDate)
+		}
+		if output.Cfx.MSG.TaxBody7211.TaxInfo7211[0].Payment7211.TraNo == "T1" {
+			t.Errorf("pass=%v TraNo应重新生成", pass)
+		}
+
+		// Reserve和未建模的元素只在透传模式下保留
+		for _, want := range []string{"<Reserve>R1</Reserve>", `<Payment7211 kind="x">`, "<ExtInfo>e1</ExtInfo>"} {
+			if strings.Contains(output.Body, want) != pass {
+				t.Errorf("pass=%v 报文中%s的存在情况不正确:\n%s", pass, want, output.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReconcileFileName 对账报告文件名
+const ReconcileFileName = "reconciliation.csv"
+
+// reconcileKey 对账维度：国库代码 + 征收机关代码
+type reconcileKey struct {
+	TreCode    string
+	TaxOrgCode string
+}
+
+// ReconcileRow 一个源文件在一个国库/征收机关下的对账结果
+type ReconcileRow struct {
+	SourceFile  string
+	TreCode     string
+	TaxOrgCode  string
+	SourceCount int
+	OutputCount int
+	SourceAmt   Amount
+	OutputAmt   Amount
+}
+
+// OK 笔数和金额均一致
+func (r ReconcileRow) OK() bool {
+	return r.SourceCount == r.OutputCount && r.SourceAmt == r.OutputAmt
+}
+
+// String 对账结果说明
+func (r ReconcileRow) String() string {
+	return fmt.Sprintf("国库[%s]征收机关[%s] 源笔数%d/金额%s, 输出笔数%d/金额%s",
+		r.TreCode, r.TaxOrgCode, r.SourceCount, r.SourceAmt, r.OutputCount, r.OutputAmt)
+}
+
+// Reconcile 按国库、征收机关核对源报文与输出报文的笔数和金额
+// 源：6100明细TaxAmt合计、7211明细TraAmt合计、7221明细Amt合计；输出：7211/7221的AllAmt合计及Detail7211Count/Detail7221Count
+// 压测放大的副本金额可能浮动，只核对原报文
+func Reconcile(sourceFile string, source *CFX, outputs []*OutputData) ([]ReconcileRow, error) {
+	rows := map[reconcileKey]*ReconcileRow{}
+	row := func(key reconcileKey) *ReconcileRow {
+		if r, ok := rows[key]; ok {
+			return r
+		}
+		r := &ReconcileRow{SourceFile: sourceFile, TreCode: key.TreCode, TaxOrgCode: key.TaxOrgCode}
+		rows[key] = r
+		return r
+	}
+
+	// 源报文
+	msg := source.MSG
+	switch {
+	case msg.TaxHead6100 != nil && msg.TaxBody6100 != nil:
+		for _, bill := range msg.TaxBody6100.TaxBill6100 {
+			amt, err := ParseAmount(bill.TaxAmt)
+			if err != nil {
+				return nil, fmt.Errorf("对账失败: 6100明细ExpTaxVouNo[%s]金额错误: %v", bill.ExpTaxVouNo, err)
+			}
+			r := row(reconcileKey{msg.TaxHead6100.TreCode, bill.TaxOrgCode})
+			r.SourceCount++
+			r.SourceAmt += amt
+		}
+	case msg.BatchHead7211 != nil && msg.TaxBody7211 != nil:
+		var treCode string
+		if msg.TurnAccount7211 != nil {
+			treCode = msg.TurnAccount7211.PayeeTreCode
+		}
+		r := row(reconcileKey{treCode, msg.BatchHead7211.TaxOrgCode})
+		for _, info := range msg.TaxBody7211.TaxInfo7211 {
+			amt, err := ParseAmount(info.Payment7211.TraAmt)
+			if err != nil {
+				return nil, fmt.Errorf("对账失败: 7211明细TraNo[%s]金额错误: %v", info.Payment7211.TraNo, err)
+			}
+			r.SourceCount++
+			r.SourceAmt += amt
+		}
+	case msg.BatchHead7221 != nil && msg.DrawbackBody7221 != nil:
+		r := row(reconcileKey{msg.BatchHead7221.DrawBackTreCode, msg.BatchHead7221.TaxOrgCode})
+		for _, info := range msg.DrawbackBody7221.DrawbackInfo7221 {
+			amt, err := ParseAmount(info.Amt)
+			if err != nil {
+				return nil, fmt.Errorf("对账失败: 7221明细TraNo[%s]金额错误: %v", info.TraNo, err)
+			}
+			r.SourceCount++
+			r.SourceAmt += amt
+		}
+	}
+
+	// 输出报文，压测放大的副本不参与对账
+	for _, data := range outputs {
+		if data.Cfx == nil || data.Variant > 0 {
+			continue
+		}
+		var key reconcileKey
+		var allAmt string
+		var count int
+		switch out := data.Cfx.MSG; {
+		case out.BatchHead7211 != nil:
+			if out.TurnAccount7211 != nil {
+				key.TreCode = out.TurnAccount7211.PayeeTreCode
+			}
+			key.TaxOrgCode = out.BatchHead7211.TaxOrgCode
+			allAmt, count = out.BatchHead7211.AllAmt, data.Detail7211Count
+		case out.BatchHead7221 != nil:
+			key = reconcileKey{out.BatchHead7221.DrawBackTreCode, out.BatchHead7221.TaxOrgCode}
+			allAmt, count = out.BatchHead7221.AllAmt, data.Detail7221Count
+		default:
+			continue
+		}
+		amt, err := ParseAmount(allAmt)
+		if err != nil {
+			return nil, fmt.Errorf("对账失败: 输出报文MsgID[%s]的AllAmt错误: %v", data.Cfx.HEAD.MsgID, err)
+		}
+		r := row(key)
+		r.OutputCount += count
+		r.OutputAmt += amt
+	}
+
+	result := make([]ReconcileRow, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TreCode != result[j].TreCode {
+			return result[i].TreCode < result[j].TreCode
+		}
+		return result[i].TaxOrgCode < result[j].TaxOrgCode
+	})
+	return result, nil
+}
+
+// FormatReconcileReport 生成对账不一致的报告内容，全部一致时返回空字符串
+func FormatReconcileReport(rows []ReconcileRow) string {
+	var report strings.Builder
+	for _, r := range rows {
+		if r.OK() {
+			continue
+		}
+		if report.Len() == 0 {
+			fmt.Fprintf(&report, "源文件: %s\n对账不一致:\n", r.SourceFile)
+		}
+		fmt.Fprintf(&report, "  - %s\n", r)
+	}
+	if report.Len() > 0 {
+		report.WriteString("\n")
+	}
+	return report.String()
+}
+
+// WriteReconciliation 将本次运行的对账结果写入目录下的 reconciliation.csv
+func WriteReconciliation(dir string, rows []ReconcileRow) error {
+	records := make([][]string, 0, len(rows))
+	for _, r := range rows {
+		result := "一致"
+		if !r.OK() {
+			result = "不一致"
+		}
+		records = append(records, []string{
+			r.SourceFile, r.TreCode, r.TaxOrgCode,
+			strconv.Itoa(r.SourceCount), strconv.Itoa(r.OutputCount),
+			r.SourceAmt.String(), r.OutputAmt.String(), result,
+		})
+	}
+	header := []string{"SourceFile", "TreCode", "TaxOrgCode", "SourceCount", "OutputCount", "SourceAmt", "OutputAmt", "Result"}
+	if err := writeExcelCSV(filepath.Join(dir, ReconcileFileName), header, records); err != nil {
+		return fmt.Errorf("写入对账报告失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReconcile6100(t *testing.T) {
+	defer func(charset string) { outputCharset = charset }(outputCharset)
+	outputCharset = CharsetUTF8
+
+	source := new6100TestCFX("A01", "1.10", "2.20")
+	outputs, err := Convert6100To7211(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := Reconcile("a.xml", source, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || !rows[0].OK() || rows[0].TreCode != "0100" || rows[0].SourceAmt.String() != "3.30" {
+		t.Fatalf("对账结果 = %+v", rows)
+	}
+	if report := FormatReconcileReport(rows); report != "" {
+		t.Errorf("对账一致时不应生成报告: %s", report)
+	}
+
+	// 输出报文金额被改动后应报告不一致
+	outputs[0].Cfx.MSG.BatchHead7211.AllAmt = "3.00"
+	outputs[0].Detail7211Count = 1
+	rows, err = Reconcile("a.xml", source, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].OK() || rows[0].OutputCount != 1 || rows[0].OutputAmt.String() != "3.00" {
+		t.Fatalf("对账结果 = %+v", rows)
+	}
+	report := FormatReconcileReport(rows)
+	if !strings.Contains(report, "对账不一致") || !strings.Contains(report, "征收机关[A01]") {
+		t.Errorf("对账报告 = %s", report)
+	}
+}
+
+func TestReconcileMissingOutput(t *testing.T) {
+	source := new7221TestCFX(2)
+	rows, err := Reconcile("a.xml", source, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].OK() || rows[0].SourceCount != 2 || rows[0].OutputCount != 0 {
+		t.Errorf("没有输出报文时应对账不一致: %+v", rows)
+	}
+}
+
+func TestWriteReconciliation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "report")
+	rows := []ReconcileRow{
+		{SourceFile: "a.xml", TreCode: "0100", TaxOrgCode: "A01", SourceCount: 2, OutputCount: 2, SourceAmt: 330, OutputAmt: 330},
+		{SourceFile: "b.xml", TreCode: "0100", TaxOrgCode: "B02", SourceCount: 1, OutputCount: 0, SourceAmt: 100},
+	}
+	if err := WriteReconciliation(dir, rows); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, ReconcileFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, utf8BOM))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][7] != "一致" || records[2][7] != "不一致" || records[1][5] != "3.30" {
+		t.Errorf("对账报告内容 = %v", records)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 参考数据表，目录下的 <表名>.csv 每行为 代码,名称
+const (
+	RefTreasury    = "treasury"     // 国库代码 -> 国库名称
+	RefBank        = "bank"         // 行号 -> 银行名称
+	RefBudgetLevel = "budget_level" // 预算级次代码 -> 名称
+	RefTaxSubject  = "tax_subject"  // 税目代码 -> 名称
+)
+
+// referenceTables 支持的参考数据表
+var referenceTables = []string{RefTreasury, RefBank, RefBudgetLevel, RefTaxSubject}
+
+// ReferenceMissingFileName 查不到的参考数据报告文件名
+const ReferenceMissingFileName = "reference_missing.csv"
+
+// defaultBudgetLevels 内置的预算级次代码表
+var defaultBudgetLevels = map[string]string{
+	"1": "中央",
+	"2": "省",
+	"3": "市",
+	"4": "县",
+	"5": "乡",
+}
+
+// referenceMiss 一个查不到的代码
+type referenceMiss struct {
+	Table string
+	Code  string
+}
+
+// ReferenceData 代码->名称参考数据，转换时填充名称，校验时检查代码是否存在
+// 未加载的表不做查找，也不报告
+type ReferenceData struct {
+	tables map[string]map[string]string
+	strict bool
+
+	lock    sync.Mutex
+	missing map[referenceMiss]int
+	files   map[referenceMiss]string // 首次出现的源文件
+}
+
+// referenceData 当前运行的参考数据，由ConfigureReferenceData设置，为nil时不处理
+var referenceData *ReferenceData
+
+// LoadReferenceData 加载参考数据目录，目录中不存在的表不加载；dir为空时只有内置的预算级次表
+func LoadReferenceData(dir string) (*ReferenceData, error) {
+	r := &ReferenceData{
+		tables:  map[string]map[string]string{RefBudgetLevel: defaultBudgetLevels},
+		missing: map[referenceMiss]int{},
+		files:   map[referenceMiss]string{},
+	}
+	if dir == "" {
+		return r, nil
+	}
+	for _, table := range referenceTables {
+		path := filepath.Join(dir, table+".csv")
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		entries, err := loadReferenceTable(path)
+		if err != nil {
+			return nil, err
+		}
+		r.tables[table] = entries
+	}
+	return r, nil
+}
+
+// loadReferenceTable 读取 代码,名称 格式的CSV文件，支持UTF-8和GBK，#开头的行为注释
+func loadReferenceTable(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取参考数据失败: %v", err)
+	}
+	content, _, err := DecodeXMLBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("参考数据%s解码失败: %v", path, err)
+	}
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(content, "\ufeff")))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析参考数据%s失败: %v", path, err)
+	}
+	entries := map[string]string{}
+	for i, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("参考数据%s第%d行应为 代码,名称", path, i+1)
+		}
+		entries[strings.TrimSpace(record[0])] = strings.TrimSpace(record[1])
+	}
+	return entries, nil
+}
+
+// isReferenceTable 判断是否为支持的参考数据表
+func isReferenceTable(table string) bool {
+	for _, t := range referenceTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureReferenceData 按配置加载参考数据，每次转换运行开始时调用一次
+func ConfigureReferenceData(setting *Setting) error {
+	data, err := LoadReferenceData(setting.ReferenceDataDir)
+	if err != nil {
+		return err
+	}
+	data.strict = setting.ReferenceStrict
+	referenceData = data
+
+	tables := make([]string, 0, len(data.tables))
+	for table := range data.tables {
+		tables = append(tables, fmt.Sprintf("%s(%d)", table, len(data.tables[table])))
+	}
+	sort.Strings(tables)
+	AppLogger.Printf("参考数据: %v", tables)
+	return nil
+}
+
+// Lookup 按代码查名称，表未加载或代码为空时ok为false
+func (r *ReferenceData) Lookup(table, code string) (string, bool) {
+	if r == nil || code == "" {
+		return "", false
+	}
+	name, ok := r.tables[table][code]
+	return name, ok
+}
+
+// referenceField 需要在参考数据中存在的报文字段
+type referenceField struct {
+	Table string
+	Path  string
+}
+
+// referenceFields 报文编号 -> 需要检查的字段，路径与校验规则相同
+var referenceFields = map[string][]referenceField{
+	"7211": {
+		{RefTreasury, "MSG/TurnAccount7211/PayeeTreCode"},
+		{RefBank, "MSG/TurnAccount7211/PayBnkNo"},
+		{RefBank, "MSG/TaxBody7211/TaxInfo7211/Payment7211/PayOpBnkNo"},
+		{RefBudgetLevel, "MSG/TaxBody7211/TaxInfo7211/TaxType7211/BudgetLevelCode"},
+		{RefTaxSubject, "MSG/TaxBody7211/TaxInfo7211/TaxType7211/SubjectList7211/TaxSubjectCode"},
+	},
+	"7221": {
+		{RefTreasury, "MSG/BatchHead7221/DrawBackTreCode"},
+		{RefBank, "MSG/DrawbackBody7221/DrawbackInfo7221/PayeeBankNo"},
+		{RefBank, "MSG/DrawbackBody7221/DrawbackInfo7221/PayeeOpBkCode"},
+		{RefBudgetLevel, "MSG/DrawbackBody7221/DrawbackInfo7221/BdgLevel"},
+	},
+}
+
+// Check 检查报文中的代码是否都能在参考数据中查到，查不到的记录到本次运行的报告中
+// 严格模式下返回校验错误，报文不会被发送
+func (r *ReferenceData) Check(cfx *CFX, sourceFile string) []ValidationError {
+	if r == nil || cfx == nil {
+		return nil
+	}
+	var fields map[string][]xmlFieldValue
+	var errs []ValidationError
+	for _, ref := range referenceFields[cfx.HEAD.MsgNo] {
+		if _, ok := r.tables[ref.Table]; !ok {
+			continue
+		}
+		if fields == nil {
+			fields = map[string][]xmlFieldValue{}
+			collectXMLFields(reflect.ValueOf(cfx).Elem(), "", "", fields)
+		}
+		for _, field := range fields[ref.Path] {
+			if field.Value == "" {
+				continue
+			}
+			if _, ok := r.Lookup(ref.Table, field.Value); ok {
+				continue
+			}
+			r.recordMiss(referenceMiss{ref.Table, field.Value}, sourceFile)
+			if r.strict {
+				errs = append(errs, ValidationError{Path: field.Path, Value: field.Value, Message: "参考数据" + ref.Table + "中不存在"})
+			}
+		}
+	}
+	return errs
+}
+
+// recordMiss 记录查不到的代码
+func (r *ReferenceData) recordMiss(miss referenceMiss, sourceFile string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.missing[miss] == 0 {
+		r.files[miss] = sourceFile
+	}
+	r.missing[miss]++
+}
+
+// WriteReferenceMissing 将本次运行中查不到的代码写入目录下的 reference_missing.csv，没有时不生成文件
+func (r *ReferenceData) WriteReferenceMissing(dir string) error {
+	if r == nil || len(r.missing) == 0 {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	misses := make([]referenceMiss, 0, len(r.missing))
+	for miss := range r.missing {
+		misses = append(misses, miss)
+	}
+	sort.Slice(misses, func(i, j int) bool {
+		if misses[i].Table != misses[j].Table {
+			return misses[i].Table < misses[j].Table
+		}
+		return misses[i].Code < misses[j].Code
+	})
+
+	rows := make([][]string, 0, len(misses))
+	for _, miss := range misses {
+		rows = append(rows, []string{miss.Table, miss.Code, strconv.Itoa(r.missing[miss]), r.files[miss]})
+	}
+	if err := writeExcelCSV(filepath.Join(dir, ReferenceMissingFileName), []string{"Table", "Code", "Count", "FirstSourceFile"}, rows); err != nil {
+		return fmt.Errorf("写入参考数据缺失报告失败: %v", err)
+	}
+	AppLogger.Printf("参考数据中查不到%d个代码，详见: %s", len(misses), filepath.Join(dir, ReferenceMissingFileName))
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReferenceDataLookups(t *testing.T) {
+	defer func(data *ReferenceData) { referenceData = data }(referenceData)
+	referenceData = &ReferenceData{tables: map[string]map[string]string{
+		RefTreasury:    {"0100": "中心国库"},
+		RefBudgetLevel: defaultBudgetLevels,
+	}}
+
+	mapping := defaultFieldMapping7211()
+	mapping["PayBnkNo"] = FieldRule{Type: MappingLookup, Source: "PayBkCode", Table: map[string]string{"0100": "映射表优先"}, RefTable: RefTreasury}
+	head := &TaxHead6100{TreCode: "0100", PayBkCode: "0100"}
+	tests := []struct {
+		name string
+		head *TaxHead6100
+		bill *TaxBill6100
+		want string
+	}{
+		{"PayeeTreName", head, nil, "中心国库"},
+		{"PayeeTreName", &TaxHead6100{TreCode: "9999"}, nil, "收款国库名称"},
+		{"BudgetLevelName", head, &TaxBill6100{BudgetLevelCode: "4"}, "县"},
+		{"BudgetLevelName", head, &TaxBill6100{BudgetLevelCode: "9"}, "省"},
+		{"PayBnkNo", head, nil, "映射表优先"},
+	}
+	for _, tt := range tests {
+		if got := mapping.Value(tt.name, tt.head, tt.bill); got != tt.want {
+			t.Errorf("Value(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if err := (FieldRule{Type: MappingLookup, Source: "TreCode", RefTable: "unknown"}).validate(); err == nil {
+		t.Error("未知的参考数据表应校验失败")
+	}
+
+	templates := &MsgTemplates{lookups: map[string]map[string]string{RefTreasury: {"0200": "模板查找表"}}}
+	lookup := templates.funcMap()["lookup"].(func(string, string) string)
+	for key, want := range map[string]string{"0100": "中心国库", "0200": "模板查找表", "9999": ""} {
+		if got := lookup(RefTreasury, key); got != want {
+			t.Errorf("lookup(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestWriteExcelCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "report.csv")
+	if err := writeExcelCSV(path, []string{"A", "B"}, [][]string{{"1", "x,y"}}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\ufeffA,B\n1,\"x,y\"\n"; string(content) != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+}
@@ -8,17 +8,54 @@ import (
 )
 
 type Setting struct {
-	Server            string `json:"server"`
-	Username          string `json:"username"`
-	Password          string `json:"password"`
-	SedQueueTips      string `json:"sed_queue_tips"`
-	SedQueueCtbs      string `json:"sed_queue_ctbs"`
-	FilePath          string `json:"file_path"`
-	OriginalFilePath  string `json:"original_file_path"`
-	EncKey            string `json:"enc_key"`
-	DecryptedFilePath string `json:"decrypted_file_path"`
-	PayeeOpBkCode     string `json:"payee_op_bk_code"`
-	IsRunning         bool   `json:"-"`
+	Server               string   `json:"server"`
+	Username             string   `json:"username"`
+	Password             string   `json:"password"`
+	SedQueueTips         string   `json:"sed_queue_tips"`
+	SedQueueCtbs         string   `json:"sed_queue_ctbs"`
+	FilePath             string   `json:"file_path"`
+	OriginalFilePath     string   `json:"original_file_path"`
+	EncKey               string   `json:"enc_key"`
+	DecryptedFilePath    string   `json:"decrypted_file_path"`
+	PayeeOpBkCode        string   `json:"payee_op_bk_code"`
+	OutputCharset        string   `json:"output_charset"`         // 转换后文件的字符集: UTF-8/GBK/GB18030，默认GBK
+	TipsCharset          string   `json:"tips_charset"`           // 发往tips队列的字符集，默认GBK
+	CtbsCharset          string   `json:"ctbs_charset"`           // 发往ctbs队列的字符集，默认UTF-8
+	Split7221Size        int      `json:"split_7221_size"`        // 7221单个报文最大明细数，默认1000
+	Split7211Size        int      `json:"split_7211_size"`        // 6100->7211单个报文最大明细数，默认1000
+	GroupKeys7211        []string `json:"group_keys_7211"`        // 6100->7211分组字段，如TreCode、BudgetLevelCode，可组合，始终包含TaxOrgCode
+	Mapping7211File      string   `json:"mapping_7211_file"`      // 6100->7211字段映射文件，为空时使用默认映射
+	RecomputeTotals      bool     `json:"recompute_totals"`       // AllNum/AllAmt与明细合计不一致时按明细重新计算，否则报错
+	ValidationRulesFile  string   `json:"validation_rules_file"`  // 发送前校验规则文件，为空时使用默认规则
+	TemplateDir          string   `json:"template_dir"`           // 输出报文模板目录，存在<MsgNo>.tmpl时按模板生成报文
+	Deterministic        bool     `json:"deterministic"`          // 确定性转换模式：相同输入每次生成完全相同的输出
+	FixedClock           string   `json:"fixed_clock"`            // 确定性模式的业务时钟，格式 20060102150405
+	IdSeed               int64    `json:"id_seed"`                // 确定性模式的ID随机码种子
+	ExportEnvelopes      bool     `json:"export_envelopes"`       // 导出报文信封（MQ头信息+报文体）到envelopes.jsonl
+	MQQueueManager       string   `json:"mq_queue_manager"`       // MQ队列管理器，用于信封的ReplyToQMgr和MSGID，为空时使用环境配置
+	MQSourceQueue        string   `json:"mq_source_queue"`        // MQ信封的源队列，为空时使用环境配置
+	MQDestination        string   `json:"mq_destination"`         // MQ信封RFH2中的DESTINATION，为空时使用环境配置
+	MaskEnabled          bool     `json:"mask_enabled"`           // 转换时对敏感字段脱敏
+	MaskKey              string   `json:"mask_key"`               // 脱敏密钥，为空时每次运行随机生成
+	MaskRulesFile        string   `json:"mask_rules_file"`        // 脱敏规则文件（字段名->策略 hash/account/name），为空时使用默认规则
+	MaskNameDict         string   `json:"mask_name_dict"`         // 姓名替换字典文件，为空时使用内置字典
+	TargetBusinessDate   string   `json:"target_business_date"`   // 目标业务日期（YYYYMMDD），配置后所有日期字段按源报文WorkDate/ExportDate平移
+	HolidayCalendarFile  string   `json:"holiday_calendar_file"`  // 节假日日历文件
+	SkipNonWorkdays      bool     `json:"skip_non_workdays"`      // 平移后的业务日期（WorkDate、EntrustDate）遇周末、节假日时顺延到下一个工作日，税款所属期等日期只按天数平移
+	OverrideRulesFile    string   `json:"override_rules_file"`    // 字段覆盖规则文件，转换后按规则修改报文字段
+	IncludePatterns      []string `json:"include_patterns"`       // 输入文件包含规则，格式 [name|path|msgno:][re:]模式，默认匹配文件名
+	ExcludePatterns      []string `json:"exclude_patterns"`       // 输入文件排除规则，未配置时默认排除 path:**_3190_**（相对路径中含_3190_的文件），配置为空数组时不排除
+	AmplifyFactor        int      `json:"amplify_factor"`         // 压测放大倍数：每个7211/7221报文输出的份数，默认1
+	AmplifyAmountPercent float64  `json:"amplify_amount_percent"` // 压测副本的明细金额随机浮动比例，如0.1表示±10%
+	AmplifyPerturbPayee  bool     `json:"amplify_perturb_payee"`  // 压测副本是否随机替换收付款人信息
+	SyntheticProfile     string   `json:"synthetic_profile"`      // 合成报文配置文件，配置后不读取原始文件，按配置生成7211/7221批次
+	EnvironmentsFile     string   `json:"environments_file"`      // 环境配置文件，定义各TIPS测试节点的SRC/DES/APP/VER和MQ地址
+	Environment          string   `json:"environment"`            // 目标环境名称，为空时不改写报文头的SRC/DES/APP/VER
+	PassThrough          bool     `json:"pass_through"`           // 透传模式：7221/7211在源报文原文上只改写ID、日期、PayeeOpBkCode等字段，未建模的元素、属性和顺序保持不变
+	PrettyXML            bool     `json:"pretty_xml"`             // 输出报文缩进换行，便于人工查看，默认紧凑输出
+	ReferenceDataDir     string   `json:"reference_data_dir"`     // 参考数据目录：treasury/bank/budget_level/tax_subject.csv，每行为 代码,名称
+	ReferenceStrict      bool     `json:"reference_strict"`       // 参考数据中查不到代码时报文校验不通过，否则只在报告中列出
+	IsRunning            bool     `json:"-"`
 }
 
 const savedfile = "settings.json"
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 金额分布
+const (
+	AmountUniform = "uniform" // 在Min和Max之间均匀分布
+	AmountFixed   = "fixed"   // 固定为Value
+)
+
+// SyntheticAmount 明细金额分布
+type SyntheticAmount struct {
+	Distribution string `json:"distribution"`
+	Min          string `json:"min,omitempty"`
+	Max          string `json:"max,omitempty"`
+	Value        string `json:"value,omitempty"`
+}
+
+// SyntheticProfile 合成报文的配置
+// 每个批次生成一个源报文（6100或7221），再走正常的转换流程生成7211/7221
+type SyntheticProfile struct {
+	Batches7211     int             `json:"batches_7211"`      // 7211批次数（按6100源报文生成）
+	Batches7221     int             `json:"batches_7221"`      // 7221批次数
+	DetailsPerBatch int             `json:"details_per_batch"` // 每批次明细数
+	Amount          SyntheticAmount `json:"amount"`            // 明细金额分布
+	TreCodes        []string        `json:"tre_codes"`         // 国库代码，按批次轮流使用
+	TaxOrgCodes     []string        `json:"tax_org_codes"`     // 征收机关代码，按批次轮流使用
+	BudgetSubjects  []string        `json:"budget_subjects"`   // 预算科目代码，明细随机选取
+	BudgetLevels    []string        `json:"budget_levels"`     // 预算级次代码，明细随机选取
+	PayBkCode       string          `json:"pay_bk_code"`       // 付款行行号
+}
+
+// LoadSyntheticProfile 加载合成报文配置，未配置的项使用默认值
+func LoadSyntheticProfile(path string) (*SyntheticProfile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取合成报文配置失败: %v", err)
+	}
+	profile := &SyntheticProfile{}
+	if err := json.Unmarshal(content, profile); err != nil {
+		return nil, fmt.Errorf("解析合成报文配置失败: %v", err)
+	}
+
+	if profile.DetailsPerBatch <= 0 {
+		profile.DetailsPerBatch = 10
+	}
+	if profile.Amount.Distribution == "" {
+		profile.Amount.Distribution = AmountUniform
+	}
+	if profile.Amount.Min == "" {
+		profile.Amount.Min = "1.00"
+	}
+	if profile.Amount.Max == "" {
+		profile.Amount.Max = "1000.00"
+	}
+	if len(profile.TreCodes) == 0 {
+		profile.TreCodes = []string{"1350100000"}
+	}
+	if len(profile.TaxOrgCodes) == 0 {
+		profile.TaxOrgCodes = []string{"13501000000"}
+	}
+	if len(profile.BudgetSubjects) == 0 {
+		profile.BudgetSubjects = []string{"101010101"}
+	}
+	if len(profile.BudgetLevels) == 0 {
+		profile.BudgetLevels = []string{"1"}
+	}
+	if profile.PayBkCode == "" {
+		profile.PayBkCode = "319376074422"
+	}
+	if _, err := profile.Amount.next(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// next 按分布生成一个明细金额
+func (a SyntheticAmount) next() (Amount, error) {
+	switch a.Distribution {
+	case AmountFixed:
+		value, err := ParseAmount(a.Value)
+		if err != nil {
+			return 0, fmt.Errorf("合成报文配置的固定金额错误: %v", err)
+		}
+		return value, nil
+	case AmountUniform:
+		min, err := ParseAmount(a.Min)
+		if err != nil {
+			return 0, fmt.Errorf("合成报文配置的最小金额错误: %v", err)
+		}
+		max, err := ParseAmount(a.Max)
+		if err != nil {
+			return 0, fmt.Errorf("合成报文配置的最大金额错误: %v", err)
+		}
+		if min <= 0 || max < min {
+			return 0, fmt.Errorf("合成报文配置的金额范围[%s, %s]错误", a.Min, a.Max)
+		}
+		return min + Amount(defaultGenerator.Intn(int(max-min)+1)), nil
+	default:
+		return 0, fmt.Errorf("合成报文配置的金额分布 %s 不支持", a.Distribution)
+	}
+}
+
+// pickString 从列表中随机选取
+func pickString(list []string) string {
+	return list[defaultGenerator.Intn(len(list))]
+}
+
+// randomDigits 生成n位随机数字
+func randomDigits(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteByte(byte('0' + defaultGenerator.Intn(10)))
+	}
+	return b.String()
+}
+
+// syntheticHead 合成源报文的报文头
+func syntheticHead(msgNo string) HEAD {
+	msgId := GenerateUniqueTipsId()
+	head := HEAD{
+		VER:      defaultEnvironment.VER,
+		SRC:      defaultEnvironment.SRC,
+		DES:      defaultEnvironment.DES,
+		APP:      defaultEnvironment.APP,
+		MsgNo:    msgNo,
+		MsgID:    msgId,
+		MsgRef:   msgId,
+		WorkDate: BusinessDate(),
+	}
+	environment.ApplyHead(&head)
+	return head
+}
+
+// BuildSynthetic6100 按配置生成第batch个6100批次
+func (p *SyntheticProfile) BuildSynthetic6100(batch int) (*CFX, error) {
+	cfx := &CFX{
+		HEAD: syntheticHead("6100"),
+		MSG: MSG{
+			TaxHead6100: &TaxHead6100{
+				ExportDate: BusinessDate(),
+				ExportOrd:  strconv.Itoa(batch + 1),
+				PayBkCode:  p.PayBkCode,
+				TreCode:    p.TreCodes[batch%len(p.TreCodes)],
+			},
+			TaxBody6100: &TaxBody6100{},
+		},
+	}
+	taxOrgCode := p.TaxOrgCodes[batch%len(p.TaxOrgCodes)]
+	for i := 0; i < p.DetailsPerBatch; i++ {
+		amt, err := p.Amount.next()
+		if err != nil {
+			return nil, err
+		}
+		cfx.MSG.TaxBody6100.TaxBill6100 = append(cfx.MSG.TaxBody6100.TaxBill6100, TaxBill6100{
+			TaxOrgCode:        taxOrgCode,
+			TaxAmt:            amt.String(),
+			ExpTaxVouNo:       GenerateTaxVouNo(),
+			BudgetType:        "1",
+			TrimSign:          "0",
+			BudgetSubjectCode: pickString(p.BudgetSubjects),
+			BudgetLevelCode:   pickString(p.BudgetLevels),
+		})
+	}
+	return cfx, nil
+}
+
+// BuildSynthetic7221 按配置生成第batch个7221批次
+func (p *SyntheticProfile) BuildSynthetic7221(batch int) (*CFX, error) {
+	names := defaultMaskNameDict()
+	infos := make([]DrawbackInfo7221, 0, p.DetailsPerBatch)
+	var total Amount
+	for i := 0; i < p.DetailsPerBatch; i++ {
+		amt, err := p.Amount.next()
+		if err != nil {
+			return nil, err
+		}
+		total += amt
+		name := pickString(names.Surnames) + pickString(names.Given) + pickString(names.Given)
+		infos = append(infos, DrawbackInfo7221{
+			TraNo:              GenerateTraNo(),
+			BillDate:           BusinessDate(),
+			VouNo:              GenerateTaxVouNo(),
+			Amt:                amt.String(),
+			BdgLevel:           pickString(p.BudgetLevels),
+			BdgKind:            "1",
+			BdgSbtCode:         pickString(p.BudgetSubjects),
+			TrimSign:           "0",
+			DrawBackReasonCode: "01",
+			ApproveOrg:         p.TaxOrgCodes[batch%len(p.TaxOrgCodes)],
+			PayeeOrgCode:       randomDigits(18),
+			PayeeName:          name,
+			TaxPayName:         name,
+			PayeeBankNo:        p.PayBkCode,
+			PayeeOpBkCode:      p.PayBkCode,
+			PayeeAcct:          "6222" + randomDigits(15),
+		})
+	}
+
+	return &CFX{
+		HEAD: syntheticHead("7221"),
+		MSG: MSG{
+			BatchHead7221: &BatchHead7221{
+				TaxOrgCode:      p.TaxOrgCodes[batch%len(p.TaxOrgCodes)],
+				EntrustDate:     BusinessDate(),
+				PackNo:          GeneratePackNo(),
+				DrawBackTreCode: p.TreCodes[batch%len(p.TreCodes)],
+				ReckStyle:       "1",
+				AllNum:          strconv.Itoa(len(infos)),
+				AllAmt:          total.String(),
+			},
+			DrawbackBody7221: &DrawbackBody7221{DrawbackInfo7221: infos},
+		},
+	}, nil
+}
+
+// GenerateSyntheticFiles 按合成报文配置生成源报文文件，返回生成的目录
+// 生成的目录与配置文件平级，之后按正常流程转换、发送
+// 需在configureRun之后调用：时钟、ID生成器、日期平移和输出字符集都沿用本次运行的配置
+func GenerateSyntheticFiles(setting *Setting) (string, error) {
+	profile, err := LoadSyntheticProfile(setting.SyntheticProfile)
+	if err != nil {
+		return "", err
+	}
+
+	targetDir := filepath.Join(filepath.Dir(setting.SyntheticProfile), "synthetic_"+time.Now().Format("20060102150405"))
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return "", err
+	}
+
+	write := func(msgNo string, batch int, cfx *CFX) error {
+		content, err := generateXMLString(*cfx)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(targetDir, fmt.Sprintf("synthetic_%s_%04d.xml", msgNo, batch+1))
+		return os.WriteFile(path, []byte(content), 0644)
+	}
+	for batch := 0; batch < profile.Batches7211; batch++ {
+		cfx, err := profile.BuildSynthetic6100(batch)
+		if err != nil {
+			return "", err
+		}
+		if err := write("6100", batch, cfx); err != nil {
+			return "", fmt.Errorf("写入合成报文失败: %v", err)
+		}
+	}
+	for batch := 0; batch < profile.Batches7221; batch++ {
+		cfx, err := profile.BuildSynthetic7221(batch)
+		if err != nil {
+			return "", err
+		}
+		if err := write("7221", batch, cfx); err != nil {
+			return "", fmt.Errorf("写入合成报文失败: %v", err)
+		}
+	}
+	AppLogger.Printf("已生成合成报文: 7211批次%d个, 7221批次%d个, 目录: %s", profile.Batches7211, profile.Batches7221, targetDir)
+	return targetDir, nil
+}
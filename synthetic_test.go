@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSyntheticFiles(t *testing.T) {
+	profile := writeTestFile(t, "profile.json", `{
+		"batches_7211": 2,
+		"batches_7221": 2,
+		"details_per_batch": 5,
+		"amount": {"distribution": "fixed", "value": "12.34"}
+	}`)
+	setting := &Setting{
+		SyntheticProfile: profile,
+		OutputCharset:    CharsetUTF8,
+		Deterministic:    true,
+		FixedClock:       "20250102030405",
+		IdSeed:           7,
+	}
+	defer ConfigureDeterministic(&Setting{})
+	defer ConfigureConversion(&Setting{})
+	if err := configureRun(setting); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := GenerateSyntheticFiles(setting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil || len(files) != 4 {
+		t.Fatalf("生成文件数 = %d, want 4 (err=%v)", len(files), err)
+	}
+
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, charset, err := DecodeXMLBytes(data)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if charset != CharsetUTF8 {
+			t.Errorf("%s 字符集 = %s, want %s", path, charset, CharsetUTF8)
+		}
+		var cfx CFX
+		if err := unmarshalXMLString(content, &cfx); err != nil {
+			t.Fatalf("%s 解析失败: %v", path, err)
+		}
+
+		switch cfx.HEAD.MsgNo {
+		case "7221":
+			if err := checkBatchTotals(&cfx, false); err != nil {
+				t.Errorf("%s: %v", path, err)
+			}
+			if cfx.MSG.BatchHead7221.AllNum != "5" || cfx.MSG.BatchHead7221.AllAmt != "61.70" {
+				t.Errorf("%s 合计 = %s/%s, want 5/61.70", path, cfx.MSG.BatchHead7221.AllNum, cfx.MSG.BatchHead7221.AllAmt)
+			}
+		case "6100":
+			outputs, err := Convert6100To7211(&cfx)
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			for _, output := range outputs {
+				var converted CFX
+				if err := unmarshalXMLString(output.Body, &converted); err != nil {
+					t.Fatalf("%s 转换结果解析失败: %v", path, err)
+				}
+				if err := checkBatchTotals(&converted, false); err != nil {
+					t.Errorf("%s: %v", path, err)
+				}
+			}
+		default:
+			t.Errorf("%s 报文类型 = %s", path, cfx.HEAD.MsgNo)
+		}
+		if !strings.HasPrefix(filepath.Base(path), "synthetic_"+cfx.HEAD.MsgNo+"_") {
+			t.Errorf("%s 文件名与报文类型 %s 不一致", path, cfx.HEAD.MsgNo)
+		}
+	}
+}
@@ -13,6 +13,11 @@ type IdGenerator struct {
 	lastTimestamp int64      // 上次生成ID的时间戳
 	sequence      int64      // 序列号 (3位: 0-999)
 	lock          sync.Mutex // 互斥锁，确保线程安全
+
+	// 确定性模式：时间戳从固定时钟开始逻辑递增，随机码使用固定种子
+	deterministic bool
+	clock         time.Time
+	rnd           *rand.Rand
 }
 
 // defaultGenerator 默认的全局ID生成器实例
@@ -26,18 +31,18 @@ const EPOCH = 1704067200000
 // GeneratePackNo 生成20位的PackNo
 func GeneratePackNo() string {
 	// 18位的id+2位随机码
-	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", rand.Intn(100))
+	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", defaultGenerator.Intn(100))
 }
 
 // GenerateTraNo 生成20位的TraNo
 func GenerateTraNo() string {
 	// 18位的id+2位随机码
-	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", rand.Intn(100))
+	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", defaultGenerator.Intn(100))
 }
 
 func GenerateTaxVouNo() string {
 	// 18位的id+2位随机码
-	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", rand.Intn(100))
+	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", defaultGenerator.Intn(100))
 }
 
 // GenerateUniqueId 生成18位唯一ID (13位时间戳 + 2位机器ID + 3位序列号)
@@ -49,7 +54,7 @@ func GenerateUniqueId() string {
 // GenerateUniqueTipsId 生成20位唯一ID (13位时间戳 + 2位机器ID + 3位序列号 + 2位随机序列号)
 // 这是包级别的全局函数，可以直接调用 uniqueid.GenerateUniqueId()
 func GenerateUniqueTipsId() string {
-	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", rand.Intn(100))
+	return defaultGenerator.GenerateUniqueId() + fmt.Sprintf("%02d", defaultGenerator.Intn(100))
 }
 
 // GetGeneratorInstance 获取独立的ID生成器实例
@@ -67,14 +72,16 @@ func (g *IdGenerator) GenerateUniqueId() string {
 	defer g.lock.Unlock()
 
 	// 获取当前时间戳
-	timestamp := time.Now().UnixMilli()
+	timestamp := g.currentMillis()
 
 	// 处理时钟回拨
 	if timestamp < g.lastTimestamp {
 		// 等待时钟追上
 		for timestamp < g.lastTimestamp {
-			time.Sleep(time.Millisecond)
-			timestamp = time.Now().UnixMilli()
+			if !g.deterministic {
+				time.Sleep(time.Millisecond)
+			}
+			timestamp = g.nextMillis()
 		}
 	}
 
@@ -88,7 +95,7 @@ func (g *IdGenerator) GenerateUniqueId() string {
 		// 如果序列号用完，等待下一毫秒
 		if sequence == 0 {
 			for timestamp <= g.lastTimestamp {
-				timestamp = time.Now().UnixMilli()
+				timestamp = g.nextMillis()
 			}
 		}
 	} else {
@@ -115,3 +122,58 @@ func (g *IdGenerator) SetWorkerId(workerId int64) {
 	}
 	g.workerId = workerId
 }
+
+// SetDeterministic 切换为确定性模式：时间戳从clock开始逻辑递增，随机码按seed生成
+// 相同的clock和seed、相同的调用顺序会生成完全相同的ID序列
+func (g *IdGenerator) SetDeterministic(clock time.Time, seed int64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.deterministic = true
+	g.clock = clock
+	g.lastTimestamp = 0
+	g.sequence = 0
+	g.rnd = rand.New(rand.NewSource(seed))
+}
+
+// SetRealtime 恢复为按系统时钟生成ID
+// 同时清除上次的时间戳和序列号，避免确定性模式的固定时钟晚于系统时间时按时钟回拨一直等待
+func (g *IdGenerator) SetRealtime() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.deterministic = false
+	g.lastTimestamp = 0
+	g.sequence = 0
+	g.rnd = nil
+}
+
+// Intn 生成[0,n)的随机数，确定性模式下使用固定种子
+func (g *IdGenerator) Intn(n int) int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.rnd != nil {
+		return g.rnd.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// currentMillis 当前毫秒时间戳，确定性模式下为固定时钟且不早于上次时间戳
+func (g *IdGenerator) currentMillis() int64 {
+	if !g.deterministic {
+		return time.Now().UnixMilli()
+	}
+	if g.lastTimestamp > g.clock.UnixMilli() {
+		return g.lastTimestamp
+	}
+	return g.clock.UnixMilli()
+}
+
+// nextMillis 等待下一毫秒时获取的时间戳，确定性模式下直接逻辑加一
+func (g *IdGenerator) nextMillis() int64 {
+	if !g.deterministic {
+		return time.Now().UnixMilli()
+	}
+	return g.lastTimestamp + 1
+}
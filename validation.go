@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ValidationRule 单个字段的校验规则
+// Path 为从CFX根节点开始、以/分隔的元素路径，如 MSG/BatchHead7211/PackNo，重复元素不需要写下标
+// 长度按GB18030编码后的字节数计算（与TIPS按字节定义字段长度一致）
+type ValidationRule struct {
+	Path     string   `json:"path"`
+	Required bool     `json:"required,omitempty"` // 必填：元素必须存在且值不能为空
+	Length   int      `json:"length,omitempty"`   // 定长
+	MinLen   int      `json:"minLen,omitempty"`   // 最小长度
+	MaxLen   int      `json:"maxLen,omitempty"`   // 最大长度
+	Pattern  string   `json:"pattern,omitempty"`  // 正则表达式
+	Date     string   `json:"date,omitempty"`     // 日期格式，Go时间格式，如 20060102
+	Enum     []string `json:"enum,omitempty"`     // 代码表
+	Amount   bool     `json:"amount,omitempty"`   // 金额：最多两位小数
+
+	pattern *regexp.Regexp
+}
+
+// ValidationRules 报文编号 -> 校验规则
+type ValidationRules map[string][]ValidationRule
+
+// ValidationError 单条校验错误
+type ValidationError struct {
+	Path    string
+	Value   string
+	Message string
+}
+
+func (e ValidationError) String() string {
+	return fmt.Sprintf("%s [%s]: %s", e.Path, e.Value, e.Message)
+}
+
+// defaultValidationRules 默认校验规则，规则文件中配置的报文编号会整体覆盖默认规则
+func defaultValidationRules() ValidationRules {
+	head := []ValidationRule{
+		{Path: "HEAD/VER", Required: true, MaxLen: 4},
+		{Path: "HEAD/SRC", Required: true, Length: 12, Pattern: `^\d+$`},
+		{Path: "HEAD/DES", Required: true, Length: 12, Pattern: `^\d+$`},
+		{Path: "HEAD/APP", Required: true, MaxLen: 10},
+		{Path: "HEAD/MsgNo", Required: true, Length: 4},
+		{Path: "HEAD/MsgID", Required: true, MaxLen: 20},
+		{Path: "HEAD/MsgRef", Required: true, MaxLen: 20},
+		{Path: "HEAD/WorkDate", Required: true, Date: "20060102"},
+	}
+	return ValidationRules{
+		"7211": append(append([]ValidationRule{}, head...),
+			ValidationRule{Path: "MSG/BatchHead7211/TaxOrgCode", Required: true, MaxLen: 12},
+			ValidationRule{Path: "MSG/BatchHead7211/EntrustDate", Required: true, Date: "20060102"},
+			ValidationRule{Path: "MSG/BatchHead7211/PackNo", Required: true, MaxLen: 20},
+			ValidationRule{Path: "MSG/BatchHead7211/AllNum", Required: true, Pattern: `^[1-9]\d*$`},
+			ValidationRule{Path: "MSG/BatchHead7211/AllAmt", Required: true, Amount: true},
+			ValidationRule{Path: "MSG/TurnAccount7211/PayBnkNo", Required: true, MaxLen: 12},
+			ValidationRule{Path: "MSG/TurnAccount7211/PayeeTreCode", Required: true, Length: 10},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/Payment7211/TraNo", Required: true, MaxLen: 20},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/Payment7211/TraAmt", Required: true, Amount: true},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/Payment7211/PayAcct", MaxLen: 32},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxVou7211/TaxVouNo", Required: true, MaxLen: 20},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxVou7211/BillDate", Required: true, Date: "20060102"},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxVou7211/BudgetType", Required: true, Enum: []string{"1", "2"}},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxVou7211/TrimSign", Required: true, Enum: []string{"0", "1"}},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxType7211/BudgetSubjectCode", Required: true, MaxLen: 30},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxType7211/LimitDate", Date: "20060102"},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxType7211/TaxStartDate", Date: "20060102"},
+			ValidationRule{Path: "MSG/TaxBody7211/TaxInfo7211/TaxType7211/TaxEndDate", Date: "20060102"},
+		),
+		"7221": append(append([]ValidationRule{}, head...),
+			ValidationRule{Path: "MSG/BatchHead7221/TaxOrgCode", Required: true, MaxLen: 12},
+			ValidationRule{Path: "MSG/BatchHead7221/EntrustDate", Required: true, Date: "20060102"},
+			ValidationRule{Path: "MSG/BatchHead7221/PackNo", Required: true, MaxLen: 20},
+			ValidationRule{Path: "MSG/BatchHead7221/DrawBackTreCode", Required: true, Length: 10},
+			ValidationRule{Path: "MSG/BatchHead7221/ReckStyle", Required: true, Enum: []string{"1", "2"}},
+			ValidationRule{Path: "MSG/BatchHead7221/AllNum", Required: true, Pattern: `^[1-9]\d*$`},
+			ValidationRule{Path: "MSG/BatchHead7221/AllAmt", Required: true, Amount: true},
+			ValidationRule{Path: "MSG/DrawbackBody7221/DrawbackInfo7221/TraNo", Required: true, MaxLen: 20},
+			ValidationRule{Path: "MSG/DrawbackBody7221/DrawbackInfo7221/BillDate", Required: true, Date: "20060102"},
+			ValidationRule{Path: "MSG/DrawbackBody7221/DrawbackInfo7221/Amt", Required: true, Amount: true},
+			ValidationRule{Path: "MSG/DrawbackBody7221/DrawbackInfo7221/TrimSign", Required: true, Enum: []string{"0", "1"}},
+			ValidationRule{Path: "MSG/DrawbackBody7221/DrawbackInfo7221/PayeeOpBkCode", Required: true, MaxLen: 12},
+			ValidationRule{Path: "MSG/DrawbackBody7221/DrawbackInfo7221/PayeeAcct", Required: true, MaxLen: 32},
+			ValidationRule{Path: "MSG/DrawbackBody7221/DrawbackInfo7221/PayeeName", Required: true, MaxLen: 60},
+		),
+	}
+}
+
+// validationRules 当前运行的校验规则，由ConfigureValidation设置，为nil时不校验
+var validationRules ValidationRules
+
+// ConfigureValidation 按配置加载校验规则，每次转换运行开始时调用一次
+func ConfigureValidation(setting *Setting) error {
+	rules, err := LoadValidationRules(setting.ValidationRulesFile)
+	if err != nil {
+		return err
+	}
+	validationRules = rules
+	return nil
+}
+
+// LoadValidationRules 加载校验规则文件，path为空时返回默认规则
+func LoadValidationRules(path string) (ValidationRules, error) {
+	rules := defaultValidationRules()
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取校验规则文件失败: %v", err)
+		}
+		fileRules := ValidationRules{}
+		if err := json.Unmarshal(content, &fileRules); err != nil {
+			return nil, fmt.Errorf("解析校验规则文件失败: %v", err)
+		}
+		for msgNo, msgRules := range fileRules {
+			rules[msgNo] = msgRules
+		}
+	}
+
+	for msgNo, msgRules := range rules {
+		for i := range msgRules {
+			if msgRules[i].Pattern == "" {
+				continue
+			}
+			pattern, err := regexp.Compile(msgRules[i].Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("校验规则[%s %s]正则表达式错误: %v", msgNo, msgRules[i].Path, err)
+			}
+			msgRules[i].pattern = pattern
+		}
+	}
+	return rules, nil
+}
+
+// xmlFieldValue CFX中的一个叶子元素
+type xmlFieldValue struct {
+	Path     string // 带下标的路径，用于报告
+	RulePath string // 不带下标的路径，用于匹配规则
+	Value    string
+	Field    reflect.Value // 叶子元素对应的结构体字段，结构体可寻址时可用于修改
+}
+
+// Validate 按报文编号对应的规则校验报文，返回全部校验错误
+func (rules ValidationRules) Validate(cfx *CFX) []ValidationError {
+	msgRules, ok := rules[cfx.HEAD.MsgNo]
+	if !ok {
+		return nil
+	}
+
+	fields := map[string][]xmlFieldValue{}
+	collectXMLFields(reflect.ValueOf(cfx).Elem(), "", "", fields)
+
+	var errs []ValidationError
+	for _, rule := range msgRules {
+		values := fields[rule.Path]
+		if len(values) == 0 {
+			if rule.Required {
+				errs = append(errs, ValidationError{Path: rule.Path, Message: "必填元素不存在"})
+			}
+			continue
+		}
+		for _, field := range values {
+			if msg := rule.check(field.Value); msg != "" {
+				errs = append(errs, ValidationError{Path: field.Path, Value: field.Value, Message: msg})
+			}
+		}
+	}
+	return errs
+}
+
+// check 校验单个值，通过时返回空串
+func (rule ValidationRule) check(value string) string {
+	if value == "" {
+		if rule.Required {
+			return "必填元素不能为空"
+		}
+		return ""
+	}
+
+	length := len(value)
+	if encoded, err := simplifiedchinese.GB18030.NewEncoder().String(value); err == nil {
+		length = len(encoded)
+	}
+	switch {
+	case rule.Length > 0 && length != rule.Length:
+		return fmt.Sprintf("长度应为%d，实际为%d", rule.Length, length)
+	case rule.MinLen > 0 && length < rule.MinLen:
+		return fmt.Sprintf("长度不能小于%d，实际为%d", rule.MinLen, length)
+	case rule.MaxLen > 0 && length > rule.MaxLen:
+		return fmt.Sprintf("长度不能超过%d，实际为%d", rule.MaxLen, length)
+	}
+	if rule.pattern != nil && !rule.pattern.MatchString(value) {
+		return fmt.Sprintf("不符合格式 %s", rule.Pattern)
+	}
+	if rule.Date != "" {
+		if _, err := time.Parse(rule.Date, value); err != nil {
+			return fmt.Sprintf("日期格式应为 %s", rule.Date)
+		}
+	}
+	if len(rule.Enum) > 0 && !slices.Contains(rule.Enum, value) {
+		return fmt.Sprintf("不在代码表 %v 中", rule.Enum)
+	}
+	if rule.Amount {
+		if _, err := ParseAmount(value); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// collectXMLFields 按xml标签遍历结构体，收集全部叶子元素的值
+func collectXMLFields(v reflect.Value, path, rulePath string, fields map[string][]xmlFieldValue) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			collectXMLFields(v.Elem(), path, rulePath, fields)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectXMLFields(v.Index(i), fmt.Sprintf("%s[%d]", path, i+1), rulePath, fields)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := xmlElementName(t.Field(i))
+			if name == "" {
+				continue
+			}
+			collectXMLFields(v.Field(i), joinXMLPath(path, name), joinXMLPath(rulePath, name), fields)
+		}
+	default:
+		fields[rulePath] = append(fields[rulePath], xmlFieldValue{Path: path, RulePath: rulePath, Value: fmt.Sprint(v.Interface()), Field: v})
+	}
+}
+
+// xmlElementName 获取结构体字段对应的xml元素名，非元素字段返回空串
+func xmlElementName(field reflect.StructField) string {
+	if !field.IsExported() || field.Name == "XMLName" {
+		return ""
+	}
+	tag := field.Tag.Get("xml")
+	if tag == "-" {
+		return ""
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if strings.Contains(opts, "attr") || strings.Contains(opts, "any") || strings.Contains(opts, "innerxml") || strings.Contains(opts, "chardata") {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func joinXMLPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
+
+// FormatValidationReport 生成单个报文的校验报告
+func FormatValidationReport(sourceFile, outputFile string, data *OutputData) string {
+	var report strings.Builder
+	msgNo, msgID := "", ""
+	if data.Cfx != nil {
+		msgNo, msgID = data.Cfx.HEAD.MsgNo, data.Cfx.HEAD.MsgID
+	}
+	fmt.Fprintf(&report, "源文件: %s\n输出文件: %s\n报文: %s MsgID: %s\n", sourceFile, outputFile, msgNo, msgID)
+	for _, e := range data.ValidationErrors {
+		fmt.Fprintf(&report, "  - %s\n", e)
+	}
+	report.WriteString("\n")
+	return report.String()
+}
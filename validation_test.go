@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidationRuleCheck(t *testing.T) {
+	rules, err := LoadValidationRules(writeTestFile(t, "rules.json", `{"TEST": [
+		{"path": "P", "pattern": "^\\d+$"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := rules["TEST"][0]
+
+	tests := []struct {
+		name    string
+		rule    ValidationRule
+		value   string
+		wantMsg string
+	}{
+		{"必填为空", ValidationRule{Required: true}, "", "必填元素不能为空"},
+		{"非必填为空", ValidationRule{Length: 4}, "", ""},
+		{"定长", ValidationRule{Length: 4}, "123", "长度应为4，实际为3"},
+		{"定长按GB18030字节", ValidationRule{Length: 4}, "张三", ""},
+		{"最小长度", ValidationRule{MinLen: 3}, "12", "长度不能小于3"},
+		{"最大长度", ValidationRule{MaxLen: 3}, "张三", "长度不能超过3，实际为4"},
+		{"正则通过", pattern, "0123", ""},
+		{"正则不通过", pattern, "12a", "不符合格式"},
+		{"日期", ValidationRule{Date: "20060102"}, "20250230", "日期格式应为"},
+		{"日期通过", ValidationRule{Date: "20060102"}, "20250228", ""},
+		{"代码表", ValidationRule{Enum: []string{"1", "2"}}, "3", "不在代码表"},
+		{"代码表通过", ValidationRule{Enum: []string{"1", "2"}}, "2", ""},
+		{"金额", ValidationRule{Amount: true}, "1.234", "金额格式不正确"},
+		{"金额通过", ValidationRule{Amount: true}, "-1.20", ""},
+	}
+	for _, tt := range tests {
+		got := tt.rule.check(tt.value)
+		if tt.wantMsg == "" && got != "" || !strings.Contains(got, tt.wantMsg) {
+			t.Errorf("%s: check(%q) = %q, want %q", tt.name, tt.value, got, tt.wantMsg)
+		}
+	}
+}
+
+func TestValidationRulesValidate(t *testing.T) {
+	rules, err := LoadValidationRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfx := &CFX{
+		HEAD: HEAD{VER: "1.0", SRC: "100000000000", DES: "33333333333X", APP: "TIPS", MsgNo: "7221", MsgID: "1", MsgRef: "1", WorkDate: "20250101"},
+		MSG: MSG{
+			BatchHead7221: &BatchHead7221{TaxOrgCode: "A01", EntrustDate: "20250101", PackNo: "1", DrawBackTreCode: "0100000000", ReckStyle: "1", AllNum: "2", AllAmt: "3.00"},
+			DrawbackBody7221: &DrawbackBody7221{DrawbackInfo7221: []DrawbackInfo7221{
+				{TraNo: "1", BillDate: "20250101", Amt: "1.00", TrimSign: "0", PayeeOpBkCode: "313", PayeeAcct: "1", PayeeName: "张三"},
+				{TraNo: "2", BillDate: "20250101", Amt: "2.001", TrimSign: "0", PayeeOpBkCode: "313", PayeeAcct: "1"},
+			}},
+		},
+	}
+	errs := rules.Validate(cfx)
+	got := map[string]bool{}
+	for _, e := range errs {
+		got[e.Path] = true
+	}
+	for _, path := range []string{
+		"HEAD/DES",
+		"MSG/DrawbackBody7221/DrawbackInfo7221[2]/Amt",
+		"MSG/DrawbackBody7221/DrawbackInfo7221[2]/PayeeName",
+	} {
+		if !got[path] {
+			t.Errorf("缺少%s的校验错误: %v", path, errs)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("校验错误 = %v, want 3条", errs)
+	}
+
+	// 缺少必填元素、没有规则的报文编号
+	if errs := rules.Validate(&CFX{HEAD: HEAD{MsgNo: "7211"}}); len(errs) == 0 {
+		t.Error("缺少必填元素应报错")
+	}
+	if errs := rules.Validate(&CFX{HEAD: HEAD{MsgNo: "9999"}}); errs != nil {
+		t.Errorf("没有规则的报文编号不校验: %v", errs)
+	}
+}
+
+func TestLoadValidationRules(t *testing.T) {
+	rules, err := LoadValidationRules(writeTestFile(t, "rules.json", `{"7221": [{"path": "HEAD/MsgNo", "length": 4}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules["7221"]) != 1 || len(rules["7211"]) == 0 {
+		t.Errorf("规则文件应整体覆盖7221并保留7211默认规则: %d %d", len(rules["7221"]), len(rules["7211"]))
+	}
+	for _, content := range []string{`{"7221": [{"path": "P", "pattern": "("}]}`, `{"7221": `} {
+		if _, err := LoadValidationRules(writeTestFile(t, "rules.json", content)); err == nil {
+			t.Errorf("%s 应报错", content)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrXMLPathNotFound 路径没有匹配的元素或属性
+var ErrXMLPathNotFound = errors.New("field not found")
+
+// xmlElementSpan 元素在文档中的位置
+type xmlElementSpan struct {
+	Path       []string // 从根元素开始的元素名
+	Index      []int    // 每一级在同名兄弟元素中的序号（从1开始）
+	StartBegin int      // 开始标签 <
+	StartEnd   int      // 开始标签 > 之后
+	EndBegin   int      // 结束标签 < ，自闭合元素与StartEnd相同
+	EndEnd     int      // 结束标签 > 之后
+	SelfClose  bool
+	Text       string // 直接包含的文本（已反转义）
+}
+
+// XMLEditor 基于XML词法单元的编辑器
+// 按元素路径读取、修改元素文本和属性，未修改的部分与原文档逐字节保持一致
+//
+// 路径格式：
+//
+//	HEAD/MsgNo                        从根元素下开始
+//	/CFX/HEAD/MsgNo                   从文档根开始，包含根元素名
+//	//PayeeTreCode                    任意层级的元素
+//	MSG/TaxBody7211/TaxInfo7211[2]    [n] 表示同名兄弟元素中的第n个（从1开始）
+//	MSG/Pay3001/@a                    最后一级以@开头表示属性
+type XMLEditor struct {
+	doc      string
+	elements []xmlElementSpan
+}
+
+// NewXMLEditor 解析已解码为UTF-8的XML文档
+func NewXMLEditor(doc string) (*XMLEditor, error) {
+	e := &XMLEditor{}
+	if err := e.parse(doc); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// String 返回编辑后的文档
+func (e *XMLEditor) String() string {
+	return e.doc
+}
+
+// parse 扫描文档，记录每个元素的位置
+func (e *XMLEditor) parse(doc string) error {
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	decoder.CharsetReader = utf8CharsetReader
+
+	var elements []xmlElementSpan
+	var stack []int                  // 打开的元素在elements中的下标
+	counters := []map[string]int{{}} // 每一级同名兄弟元素计数
+	for {
+		begin := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("解析XML失败: %v", err)
+		}
+		end := int(decoder.InputOffset())
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := xmlQualifiedName(t.Name)
+			span := xmlElementSpan{StartBegin: begin, StartEnd: end}
+			if len(stack) > 0 {
+				parent := elements[stack[len(stack)-1]]
+				span.Path = append(span.Path, parent.Path...)
+				span.Index = append(span.Index, parent.Index...)
+			}
+			level := counters[len(counters)-1]
+			level[name]++
+			span.Path = append(span.Path, name)
+			span.Index = append(span.Index, level[name])
+			elements = append(elements, span)
+			stack = append(stack, len(elements)-1)
+			counters = append(counters, map[string]int{})
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return fmt.Errorf("解析XML失败: 多余的结束标签 </%s>", xmlQualifiedName(t.Name))
+			}
+			span := &elements[stack[len(stack)-1]]
+			if span.Path[len(span.Path)-1] != xmlQualifiedName(t.Name) {
+				return fmt.Errorf("解析XML失败: 结束标签 </%s> 与开始标签 <%s> 不匹配", xmlQualifiedName(t.Name), span.Path[len(span.Path)-1])
+			}
+			span.EndBegin, span.EndEnd = begin, end
+			// 自闭合元素的结束标记不占用输入
+			span.SelfClose = begin == end
+			stack = stack[:len(stack)-1]
+			counters = counters[:len(counters)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				elements[stack[len(stack)-1]].Text += string(t)
+			}
+		}
+	}
+	if len(stack) > 0 {
+		path := elements[stack[len(stack)-1]].Path
+		return fmt.Errorf("解析XML失败: 元素 <%s> 没有结束标签", path[len(path)-1])
+	}
+	e.doc = doc
+	e.elements = elements
+	return nil
+}
+
+// xmlQualifiedName 带前缀的元素名
+func xmlQualifiedName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// xmlPathStep 路径中的一级
+type xmlPathStep struct {
+	Name  string
+	Index int // 0表示不限定序号
+}
+
+var xmlPathStepPattern = regexp.MustCompile(`^([^\[\]@]+)(?:\[(\d+)\])?$`)
+
+// parseXMLEditPath 解析路径，返回元素路径、是否任意层级、是否从文档根开始、属性名
+func parseXMLEditPath(path string) (steps []xmlPathStep, anywhere, rooted bool, attr string, err error) {
+	switch {
+	case strings.HasPrefix(path, "//"):
+		anywhere = true
+		path = path[2:]
+	case strings.HasPrefix(path, "/"):
+		rooted = true
+		path = path[1:]
+	}
+	parts := strings.Split(path, "/")
+	if last := parts[len(parts)-1]; strings.HasPrefix(last, "@") {
+		attr = last[1:]
+		parts = parts[:len(parts)-1]
+	} else if name, a, ok := strings.Cut(last, "@"); ok && name != "" {
+		// 也支持 Elem@attr 的写法
+		attr = a
+		parts[len(parts)-1] = name
+	}
+	for _, part := range parts {
+		m := xmlPathStepPattern.FindStringSubmatch(part)
+		if m == nil {
+			return nil, false, false, "", fmt.Errorf("路径 %s 格式错误", path)
+		}
+		step := xmlPathStep{Name: m[1]}
+		if m[2] != "" {
+			step.Index, _ = strconv.Atoi(m[2])
+		}
+		steps = append(steps, step)
+	}
+	return steps, anywhere, rooted, attr, nil
+}
+
+// match 判断元素是否匹配路径
+func (span xmlElementSpan) match(steps []xmlPathStep, anywhere, rooted bool) bool {
+	path, index := span.Path, span.Index
+	if !rooted && !anywhere {
+		// 从根元素下开始
+		if len(path) == 0 {
+			return false
+		}
+		path, index = path[1:], index[1:]
+	}
+	if anywhere {
+		if len(path) < len(steps) {
+			return false
+		}
+		offset := len(path) - len(steps)
+		path, index = path[offset:], index[offset:]
+	}
+	if len(path) != len(steps) {
+		return false
+	}
+	for i, step := range steps {
+		if path[i] != step.Name || (step.Index > 0 && index[i] != step.Index) {
+			return false
+		}
+	}
+	return true
+}
+
+// find 查找匹配路径的全部元素
+func (e *XMLEditor) find(path string) ([]int, string, error) {
+	steps, anywhere, rooted, attr, err := parseXMLEditPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var found []int
+	for i, span := range e.elements {
+		if span.match(steps, anywhere, rooted) {
+			found = append(found, i)
+		}
+	}
+	return found, attr, nil
+}
+
+// Get 读取第一个匹配元素的文本或属性值
+func (e *XMLEditor) Get(path string) (string, error) {
+	values, err := e.GetAll(path)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", ErrXMLPathNotFound
+	}
+	return values[0], nil
+}
+
+// GetAll 按文档顺序读取全部匹配元素的文本或属性值
+func (e *XMLEditor) GetAll(path string) ([]string, error) {
+	found, attr, err := e.find(path)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, i := range found {
+		span := e.elements[i]
+		if attr == "" {
+			values = append(values, span.Text)
+			continue
+		}
+		if value, _, _, ok := span.attr(e.doc, attr); ok {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// Set 将全部匹配元素的文本或属性设置为value，返回修改的个数
+func (e *XMLEditor) Set(path, value string) (int, error) {
+	return e.SetFunc(path, func() string { return value })
+}
+
+// SetFunc 将全部匹配元素的文本或属性设置为生成器的值，每个元素单独生成，返回修改的个数
+// 元素的子元素会被文本替换；属性不存在时添加到开始标签末尾
+func (e *XMLEditor) SetFunc(path string, generator ValueGenerator) (int, error) {
+	return e.Update(path, func(string) string { return generator() })
+}
+
+// Update 按原值计算全部匹配元素的新文本或属性值，按文档顺序调用，返回修改的个数
+// 新值与原值相同的元素保持原文不变；匹配的元素嵌套时只修改外层元素的文本
+func (e *XMLEditor) Update(path string, update func(old string) string) (int, error) {
+	found, attr, err := e.find(path)
+	if err != nil {
+		return 0, err
+	}
+	edits := make([]xmlEdit, 0, len(found))
+	for _, i := range found {
+		old, exists := e.value(i, attr)
+		if value := update(old); value != old || !exists {
+			edits = append(edits, xmlEdit{element: i, attr: attr, value: value})
+		}
+	}
+	return e.apply(edits)
+}
+
+// SetEach 将第k个匹配parentPath的元素下相对路径为child的元素或属性设置为values[k]，返回修改的个数
+// values的个数必须与匹配parentPath的元素个数相同；没有child的元素跳过，值与原值相同时保持原文不变
+func (e *XMLEditor) SetEach(parentPath, child string, values []string) (int, error) {
+	parents, _, err := e.find(parentPath)
+	if err != nil {
+		return 0, err
+	}
+	if len(parents) != len(values) {
+		return 0, fmt.Errorf("路径 %s 匹配%d个元素，与值的个数%d不一致", parentPath, len(parents), len(values))
+	}
+	steps, _, _, attr, err := parseXMLEditPath(child)
+	if err != nil {
+		return 0, err
+	}
+
+	var edits []xmlEdit
+	for k, p := range parents {
+		parent := e.elements[p]
+		depth := len(parent.Path)
+		// child只有属性时修改父元素本身的属性
+		for i := p; i < len(e.elements) && e.elements[i].StartBegin < parent.EndEnd; i++ {
+			span := e.elements[i]
+			relative := xmlElementSpan{Path: span.Path[depth:], Index: span.Index[depth:]}
+			if !relative.match(steps, false, true) {
+				continue
+			}
+			if old, exists := e.value(i, attr); old != values[k] || !exists {
+				edits = append(edits, xmlEdit{element: i, attr: attr, value: values[k]})
+			}
+		}
+	}
+	return e.apply(edits)
+}
+
+// Retain 保留匹配元素中keep返回true的元素，删除其余元素，返回删除的个数
+// 元素独占一行时连同所在行一起删除；keep的参数为元素在匹配结果中的序号（从1开始）
+func (e *XMLEditor) Retain(path string, keep func(n int) bool) (int, error) {
+	found, _, err := e.find(path)
+	if err != nil {
+		return 0, err
+	}
+	var removed []xmlElementSpan
+	end := -1
+	for n, i := range found {
+		span := e.elements[i]
+		// 已删除元素内部的元素随外层元素一起删除
+		if keep(n+1) || span.StartBegin < end {
+			continue
+		}
+		removed = append(removed, span)
+		end = span.EndEnd
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	doc := e.doc
+	for k := len(removed) - 1; k >= 0; k-- {
+		span := removed[k]
+		begin, end := span.StartBegin, span.EndEnd
+		lineBegin := len(strings.TrimRight(doc[:begin], " \t"))
+		rest := strings.TrimLeft(doc[end:], " \t")
+		if (lineBegin == 0 || doc[lineBegin-1] == '\n') && (strings.HasPrefix(rest, "\n") || strings.HasPrefix(rest, "\r\n")) {
+			begin = lineBegin
+			end = len(doc) - len(rest) + strings.Index(rest, "\n") + 1
+		}
+		doc = doc[:begin] + doc[end:]
+	}
+	if err := e.parse(doc); err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// xmlEdit 一次元素文本或属性的修改
+type xmlEdit struct {
+	element int
+	attr    string
+	value   string
+}
+
+// value 读取元素的文本或属性值，exists表示属性是否存在
+func (e *XMLEditor) value(i int, attr string) (string, bool) {
+	span := e.elements[i]
+	if attr == "" {
+		return span.Text, true
+	}
+	value, _, _, ok := span.attr(e.doc, attr)
+	return value, ok
+}
+
+// apply 执行按文档顺序排列的修改，从后往前替换，前面元素的位置保持不变
+func (e *XMLEditor) apply(edits []xmlEdit) (int, error) {
+	// 文本修改会替换子元素，嵌套在已修改元素内的文本修改不再执行
+	applied := edits[:0:0]
+	end := -1
+	for _, edit := range edits {
+		span := e.elements[edit.element]
+		if edit.attr == "" {
+			if span.StartBegin < end {
+				continue
+			}
+			end = span.EndEnd
+		}
+		applied = append(applied, edit)
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+
+	doc := e.doc
+	for k := len(applied) - 1; k >= 0; k-- {
+		span := e.elements[applied[k].element]
+		value := applied[k].value
+		if attr := applied[k].attr; attr != "" {
+			doc = span.setAttr(doc, attr, value)
+			continue
+		}
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, []byte(value))
+		if span.SelfClose {
+			// <A/> 改写为 <A>value</A>
+			tag := strings.TrimRight(strings.TrimSuffix(strings.TrimRight(doc[span.StartBegin:span.StartEnd], " \t\r\n"), ">"), "/ \t\r\n")
+			name := span.Path[len(span.Path)-1]
+			doc = doc[:span.StartBegin] + tag + ">" + escaped.String() + "</" + name + ">" + doc[span.StartEnd:]
+			continue
+		}
+		doc = doc[:span.StartEnd] + escaped.String() + doc[span.EndBegin:]
+	}
+	if err := e.parse(doc); err != nil {
+		return 0, err
+	}
+	return len(applied), nil
+}
+
+var xmlAttrPattern = regexp.MustCompile(`([^\s=<>/]+)\s*=\s*("[^"]*"|'[^']*')`)
+
+// attr 在开始标签中查找属性，返回反转义后的值及值（不含引号）在文档中的位置
+func (span xmlElementSpan) attr(doc, name string) (string, int, int, bool) {
+	tag := doc[span.StartBegin:span.StartEnd]
+	for _, m := range xmlAttrPattern.FindAllStringSubmatchIndex(tag, -1) {
+		if tag[m[2]:m[3]] != name {
+			continue
+		}
+		start, end := span.StartBegin+m[4]+1, span.StartBegin+m[5]-1
+		var value string
+		decoder := xml.NewDecoder(strings.NewReader("<a>" + doc[start:end] + "</a>"))
+		if err := decoder.Decode(&value); err != nil {
+			value = doc[start:end]
+		}
+		return value, start, end, true
+	}
+	return "", 0, 0, false
+}
+
+// setAttr 设置属性值，属性不存在时添加
+func (span xmlElementSpan) setAttr(doc, name, value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	if _, start, end, ok := span.attr(doc, name); ok {
+		quote := doc[start-1 : start]
+		v := escaped.String()
+		if quote == "'" {
+			v = strings.ReplaceAll(v, "'", "&#39;")
+		}
+		return doc[:start] + v + doc[end:]
+	}
+	// 插入到 > 或 /> 之前
+	insertAt := span.StartEnd - 1
+	if span.SelfClose {
+		insertAt = strings.LastIndex(doc[span.StartBegin:span.StartEnd], "/") + span.StartBegin
+	}
+	return doc[:insertAt] + " " + name + `="` + escaped.String() + `"` + doc[insertAt:]
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const xmlEditTestDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<CFX>
+  <HEAD><MsgNo>7211</MsgNo><MsgID>001</MsgID></HEAD>
+  <MSG>
+    <!-- 注释保持不变 -->
+    <TaxInfo7211 seq='1'><TraNo>01</TraNo><Sub><TraNo>inner1</TraNo></Sub></TaxInfo7211>
+    <TaxInfo7211 seq="2"><TraNo>02</TraNo><Sub><TraNo>inner2</TraNo></Sub><Sub><TraNo>inner3</TraNo></Sub></TaxInfo7211>
+    <Reserve/>
+    <Empty a="1" />
+    <ns:Ext xmlns:ns="urn:x" ns:kind="k"><ns:Code>C1</ns:Code></ns:Ext>
+    <Text>a &amp; b</Text>
+  </MSG>
+</CFX>`
+
+func newTestXMLEditor(t *testing.T) *XMLEditor {
+	t.Helper()
+	e, err := NewXMLEditor(xmlEditTestDoc)
+	if err != nil {
+		t.Fatalf("NewXMLEditor: %v", err)
+	}
+	return e
+}
+
+func TestXMLEditorGetAll(t *testing.T) {
+	e := newTestXMLEditor(t)
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"HEAD/MsgNo", []string{"7211"}},
+		{"/CFX/HEAD/MsgID", []string{"001"}},
+		{"MSG/TaxInfo7211/TraNo", []string{"01", "02"}},
+		{"MSG/TaxInfo7211[2]/TraNo", []string{"02"}},
+		{"MSG/TaxInfo7211[2]/Sub[2]/TraNo", []string{"inner3"}},
+		{"MSG/TaxInfo7211/Sub/TraNo", []string{"inner1", "inner2", "inner3"}},
+		{"MSG/TaxInfo7211/Sub[1]/TraNo", []string{"inner1", "inner2"}},
+		{"//TraNo", []string{"01", "inner1", "02", "inner2", "inner3"}},
+		{"//Sub/TraNo", []string{"inner1", "inner2", "inner3"}},
+		{"//TaxInfo7211[1]/TraNo", []string{"01"}},
+		{"MSG/TaxInfo7211/@seq", []string{"1", "2"}},
+		{"MSG/TaxInfo7211[2]@seq", []string{"2"}},
+		{"MSG/Empty/@a", []string{"1"}},
+		{"MSG/ns:Ext/ns:Code", []string{"C1"}},
+		{"MSG/ns:Ext/@ns:kind", []string{"k"}},
+		{"MSG/Text", []string{"a & b"}},
+		{"MSG/Reserve", []string{""}},
+		{"MSG/TaxInfo7211[3]/TraNo", nil},
+		{"CFX/HEAD/MsgNo", nil},
+		{"MSG/Empty/@b", nil},
+	}
+	for _, tt := range tests {
+		got, err := e.GetAll(tt.path)
+		if err != nil {
+			t.Errorf("GetAll(%s): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetAll(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := e.Get("HEAD/None"); !errors.Is(err, ErrXMLPathNotFound) {
+		t.Errorf("Get不存在的路径应返回ErrXMLPathNotFound, got %v", err)
+	}
+	for _, path := range []string{"MSG/TaxInfo7211[x]", "MSG//TraNo", "MSG/[1]"} {
+		if _, err := e.GetAll(path); err == nil {
+			t.Errorf("GetAll(%s) 路径格式错误时应返回错误", path)
+		}
+	}
+}
+
+func TestXMLEditorSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		value string
+		count int
+		old   string // 替换前的片段
+		new   string // 替换后的片段
+	}{
+		{"修改文本", "HEAD/MsgID", "002", 1, "<MsgID>001</MsgID>", "<MsgID>002</MsgID>"},
+		{"按序号修改重复元素", "MSG/TaxInfo7211[2]/TraNo", "99", 1, "<TraNo>02</TraNo>", "<TraNo>99</TraNo>"},
+		{"修改嵌套同名元素", "MSG/TaxInfo7211[2]/Sub[2]/TraNo", "x", 1, "<TraNo>inner3</TraNo>", "<TraNo>x</TraNo>"},
+		{"转义文本", "MSG/Text", "<1&2>", 1, "<Text>a &amp; b</Text>", "<Text>&lt;1&amp;2&gt;</Text>"},
+		{"自闭合元素", "MSG/Reserve", "R", 1, "<Reserve/>", "<Reserve>R</Reserve>"},
+		{"带属性的自闭合元素", "MSG/Empty", "E", 1, `<Empty a="1" />`, `<Empty a="1">E</Empty>`},
+		{"替换双引号属性", "MSG/TaxInfo7211[2]/@seq", "9", 1, `seq="2"`, `seq="9"`},
+		{"替换单引号属性", "MSG/TaxInfo7211[1]/@seq", "it's", 1, `seq='1'`, `seq='it&#39;s'`},
+		{"添加属性", "HEAD/@id", `a"b`, 1, "<HEAD>", `<HEAD id="a&#34;b">`},
+		{"自闭合元素添加属性", "MSG/Reserve/@x", "1", 1, "<Reserve/>", `<Reserve x="1"/>`},
+		{"带前缀的元素", "MSG/ns:Ext/ns:Code", "C2", 1, "<ns:Code>C1</ns:Code>", "<ns:Code>C2</ns:Code>"},
+		{"带前缀的属性", "MSG/ns:Ext/@ns:kind", "k2", 1, `ns:kind="k"`, `ns:kind="k2"`},
+		{"没有匹配", "MSG/None", "x", 0, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestXMLEditor(t)
+			count, err := e.Set(tt.path, tt.value)
+			if err != nil {
+				t.Fatalf("Set(%s): %v", tt.path, err)
+			}
+			if count != tt.count {
+				t.Fatalf("Set(%s) 修改了%d个, want %d", tt.path, count, tt.count)
+			}
+			want := strings.Replace(xmlEditTestDoc, tt.old, tt.new, 1)
+			if got := e.String(); got != want {
+				t.Errorf("Set(%s) 结果不一致:\n got: %s\nwant: %s", tt.path, got, want)
+			}
+			if tt.count > 0 {
+				if got, err := e.Get(tt.path); err != nil || got != tt.value {
+					t.Errorf("Set后Get(%s) = %q, %v, want %q", tt.path, got, err, tt.value)
+				}
+			}
+		})
+	}
+}
+
+func TestXMLEditorSetFuncPreservesDocument(t *testing.T) {
+	e := newTestXMLEditor(t)
+	n := 0
+	count, err := e.SetFunc("//TraNo", func() string {
+		n++
+		return strings.Repeat("N", n)
+	})
+	if err != nil || count != 5 {
+		t.Fatalf("SetFunc(//TraNo) = %d, %v, want 5", count, err)
+	}
+	// 按文档顺序生成，未修改的部分（声明、注释、空白、属性引号）逐字节保持不变
+	want := xmlEditTestDoc
+	for i, old := range []string{"01", "inner1", "02", "inner2", "inner3"} {
+		want = strings.Replace(want, "<TraNo>"+old+"</TraNo>", "<TraNo>"+strings.Repeat("N", i+1)+"</TraNo>", 1)
+	}
+	if got := e.String(); got != want {
+		t.Errorf("SetFunc 结果不一致:\n got: %s\nwant: %s", got, want)
+	}
+
+	// 修改后再按新的位置继续编辑
+	if _, err := e.Set("MSG/TaxInfo7211[1]/@seq", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := e.GetAll("//TraNo"); !reflect.DeepEqual(got, []string{"N", "NN", "NNN", "NNNN", "NNNNN"}) {
+		t.Errorf("连续编辑后 //TraNo = %q", got)
+	}
+}
+
+func TestNewXMLEditorInvalid(t *testing.T) {
+	for _, doc := range []string{
+		"<CFX><HEAD></CFX>",
+		"<CFX></HEAD></CFX>",
+		"<CFX><HEAD>",
+	} {
+		if _, err := NewXMLEditor(doc); err == nil {
+			t.Errorf("NewXMLEditor(%s) 应返回错误", doc)
+		}
+	}
+}
+
+func TestXMLEditorUpdate(t *testing.T) {
+	e := newTestXMLEditor(t)
+	count, err := e.Update("//TraNo", func(old string) string {
+		if strings.HasPrefix(old, "inner") {
+			return old
+		}
+		return "T" + old
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("Update(//TraNo) = %d, %v, want 2", count, err)
+	}
+	want := strings.Replace(strings.Replace(xmlEditTestDoc, "<TraNo>01</TraNo>", "<TraNo>T01</TraNo>", 1), "<TraNo>02</TraNo>", "<TraNo>T02</TraNo>", 1)
+	if got := e.String(); got != want {
+		t.Errorf("Update 结果不一致:\n got: %s\nwant: %s", got, want)
+	}
+
+	// 值不变时保持原文，自闭合元素不会被改写
+	e = newTestXMLEditor(t)
+	if count, err := e.Update("MSG/Reserve", func(old string) string { return old }); err != nil || count != 0 || e.String() != xmlEditTestDoc {
+		t.Errorf("值不变时不应修改文档: count=%d err=%v", count, err)
+	}
+
+	// 嵌套的同名元素只修改外层元素
+	e, err = NewXMLEditor(`<R><A><A>inner</A></A><A>x</A></R>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := e.Set("//A", "v"); err != nil || count != 2 || e.String() != `<R><A>v</A><A>v</A></R>` {
+		t.Errorf("嵌套元素 Set(//A) = %d, %v, 文档 %s", count, err, e.String())
+	}
+}
+
+func TestXMLEditorSetEach(t *testing.T) {
+	tests := []struct {
+		name    string
+		parent  string
+		child   string
+		values  []string
+		count   int
+		replace map[string]string
+		wantErr bool
+	}{
+		{"按父元素顺序设置", "MSG/TaxInfo7211", "TraNo", []string{"A", "B"}, 2,
+			map[string]string{"<TraNo>01</TraNo>": "<TraNo>A</TraNo>", "<TraNo>02</TraNo>": "<TraNo>B</TraNo>"}, false},
+		{"值相同时不修改", "MSG/TaxInfo7211", "TraNo", []string{"01", "B"}, 1,
+			map[string]string{"<TraNo>02</TraNo>": "<TraNo>B</TraNo>"}, false},
+		{"嵌套子元素", "MSG/TaxInfo7211", "Sub/TraNo", []string{"x", "y"}, 3,
+			map[string]string{"<TraNo>inner1</TraNo>": "<TraNo>x</TraNo>", "<TraNo>inner2</TraNo>": "<TraNo>y</TraNo>", "<TraNo>inner3</TraNo>": "<TraNo>y</TraNo>"}, false},
+		{"按序号的子元素", "MSG/TaxInfo7211", "Sub[2]/TraNo", []string{"x", "y"}, 1,
+			map[string]string{"<TraNo>inner3</TraNo>": "<TraNo>y</TraNo>"}, false},
+		{"属性", "MSG/TaxInfo7211", "@seq", []string{"a", "b"}, 2,
+			map[string]string{"seq='1'": "seq='a'", `seq="2"`: `seq="b"`}, false},
+		{"没有子元素的跳过", "MSG/TaxInfo7211", "None", []string{"A", "B"}, 0, nil, false},
+		{"个数不一致", "MSG/TaxInfo7211", "TraNo", []string{"A"}, 0, nil, true},
+		{"根元素下的单个元素", "HEAD", "MsgID", []string{"002"}, 1,
+			map[string]string{"<MsgID>001</MsgID>": "<MsgID>002</MsgID>"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestXMLEditor(t)
+			count, err := e.SetEach(tt.parent, tt.child, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetEach err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if count != tt.count {
+				t.Errorf("SetEach 修改了%d个, want %d", count, tt.count)
+			}
+			want := xmlEditTestDoc
+			for old, new := range tt.replace {
+				want = strings.Replace(want, old, new, 1)
+			}
+			if got := e.String(); got != want {
+				t.Errorf("SetEach 结果不一致:\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+func TestXMLEditorRetain(t *testing.T) {
+	doc := "<R>\n  <A>1</A>\n  <A>2</A>\r\n  <A>3<A>nested</A></A><B/>\n</R>"
+	tests := []struct {
+		name    string
+		path    string
+		keep    []int
+		removed int
+		want    string
+	}{
+		{"保留第一个", "A", []int{1}, 2, "<R>\n  <A>1</A>\n  <B/>\n</R>"},
+		{"保留第二个", "A", []int{2}, 2, "<R>\n  <A>2</A>\r\n  <B/>\n</R>"},
+		{"全部保留", "A", []int{1, 2, 3}, 0, doc},
+		{"删除独占一行的元素及CRLF", "A", []int{1, 3}, 1, "<R>\n  <A>1</A>\n  <A>3<A>nested</A></A><B/>\n</R>"},
+		{"嵌套元素随外层删除", "//A", []int{1, 2}, 1, "<R>\n  <A>1</A>\n  <A>2</A>\r\n  <B/>\n</R>"},
+		{"只删除内层元素", "//A", []int{1, 2, 3}, 1, "<R>\n  <A>1</A>\n  <A>2</A>\r\n  <A>3</A><B/>\n</R>"},
+		{"同一行的元素只删除元素本身", "B", nil, 1, "<R>\n  <A>1</A>\n  <A>2</A>\r\n  <A>3<A>nested</A></A>\n</R>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewXMLEditor(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keep := map[int]bool{}
+			for _, n := range tt.keep {
+				keep[n] = true
+			}
+			removed, err := e.Retain(tt.path, func(n int) bool { return keep[n] })
+			if err != nil {
+				t.Fatalf("Retain: %v", err)
+			}
+			if removed != tt.removed {
+				t.Errorf("Retain 删除了%d个, want %d", removed, tt.removed)
+			}
+			if got := e.String(); got != tt.want {
+				t.Errorf("Retain 结果不一致:\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}